@@ -2,22 +2,22 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/duc-cnzj/geekbang2md/cache"
+	"github.com/duc-cnzj/geekbang2md/retry"
 	"github.com/duc-cnzj/geekbang2md/utils"
+	"github.com/duc-cnzj/geekbang2md/waiter"
 )
 
-var c = &cache.Cache{}
-
 type Product struct {
 	ID        int `json:"id"`
 	Spu       int `json:"spu"`
@@ -775,19 +775,22 @@ func (is IntString) Swap(i, j int) {
 	is[i], is[j] = is[j], is[i]
 }
 
-func Infos(chunks IntString) (*InfosResponse, error) {
+func (c *client) Infos(chunks IntString) (*InfosResponse, error) {
 	var result *InfosResponse
 	sort.Sort(chunks)
 	idStr := strings.Join(chunks, ",")
 	cacheKey := "infos-" + utils.Md5(strings.Join(chunks, "-"))
-	file, err := c.Get(cacheKey)
+	file, err := c.cached(cacheKey)
 	if err == nil && len(file) > 0 {
 		err = json.NewDecoder(bytes.NewReader(file)).Decode(&result)
 		if err == nil {
 			return result, err
 		}
 	}
-	res, err := HttpClient.Post("https://time.geekbang.org/serv/v3/product/infos", fmt.Sprintf(`{"ids":[%s],"with_first_articles":true}`, idStr), false)
+	if c.offline && errors.Is(err, cache.ErrCorrupt) {
+		return nil, err
+	}
+	res, err := c.Post(c.baseURL+"/serv/v3/product/infos", fmt.Sprintf(`{"ids":[%s],"with_first_articles":true}`, idStr), false)
 	if err != nil {
 		return nil, err
 	}
@@ -800,7 +803,7 @@ func Infos(chunks IntString) (*InfosResponse, error) {
 		return nil, err
 	}
 	if res.StatusCode < 400 {
-		c.Set(cacheKey, result)
+		c.cache.Set(cacheKey, result, cache.Meta{URL: c.baseURL + "/serv/v3/product/infos"})
 	}
 
 	return result, nil
@@ -838,7 +841,7 @@ type SkusResponse struct {
 	Code int `json:"code"`
 }
 
-func Skus(p PType) (*SkusResponse, error) {
+func (c *client) Skus(p PType) (*SkusResponse, error) {
 	var result *SkusResponse
 	var tp int
 	switch p {
@@ -850,15 +853,18 @@ func Skus(p PType) (*SkusResponse, error) {
 		tp = 1
 	}
 	cacheKey := fmt.Sprintf("skus-%d", tp)
-	file, err := c.Get(cacheKey)
+	file, err := c.cached(cacheKey)
 	if err == nil && len(file) > 0 {
 		err = json.NewDecoder(bytes.NewReader(file)).Decode(&result)
 		if err == nil {
 			return result, err
 		}
 	}
+	if c.offline && errors.Is(err, cache.ErrCorrupt) {
+		return nil, err
+	}
 	//https://time.geekbang.org/serv/v1/column/label_skus
-	res, err := HttpClient.Post("https://time.geekbang.org/serv/v1/column/label_skus", fmt.Sprintf(`{"label_id":0,"type":%d}`, tp), false)
+	res, err := c.Post(c.baseURL+"/serv/v1/column/label_skus", fmt.Sprintf(`{"label_id":0,"type":%d}`, tp), false)
 	if err != nil {
 		return nil, err
 	}
@@ -872,17 +878,17 @@ func Skus(p PType) (*SkusResponse, error) {
 	}
 
 	if res.StatusCode < 400 {
-		c.Set(cacheKey, result)
+		c.cache.Set(cacheKey, result, cache.Meta{URL: c.baseURL + "/serv/v1/column/label_skus"})
 	}
 
 	return result, nil
 }
 
-func AllProducts(t PType) ([]Product, error) {
+func (c *client) AllProducts(t PType) ([]Product, error) {
 	var results []Product
 	page := 1
 	for page > 0 {
-		products, err := Products(page, 100, t)
+		products, err := c.Products(page, 100, t)
 		if err != nil {
 			return nil, err
 		}
@@ -896,10 +902,20 @@ func AllProducts(t PType) ([]Product, error) {
 	return results, nil
 }
 
-func Products(prev, size int, t PType) (ProjectResponse, error) {
+func (c *client) Products(prev, size int, t PType) (ProjectResponse, error) {
 	var result ProjectResponse
+	cacheKey := fmt.Sprintf("products-%s-%d-%d", t, prev, size)
+	file, err := c.cached(cacheKey)
+	if err == nil && len(file) > 0 {
+		if err = json.Unmarshal(file, &result); err == nil {
+			return result, nil
+		}
+	}
+	if c.offline && errors.Is(err, cache.ErrCorrupt) {
+		return ProjectResponse{}, err
+	}
 
-	res, err := HttpClient.Post("https://time.geekbang.org/serv/v3/learn/product", fmt.Sprintf(`{"desc":true,"expire":1,"last_learn":0,"learn_status":0,"prev":%d,"size":%d,"sort":1,"type":"%s","with_learn_count":1}`, prev, size, t), false)
+	res, err := c.Post(c.baseURL+"/serv/v3/learn/product", fmt.Sprintf(`{"desc":true,"expire":1,"last_learn":0,"learn_status":0,"prev":%d,"size":%d,"sort":1,"type":"%s","with_learn_count":1}`, prev, size, t), false)
 	if err != nil {
 		return ProjectResponse{}, err
 	}
@@ -913,7 +929,10 @@ func Products(prev, size int, t PType) (ProjectResponse, error) {
 	}
 
 	if result.Code == -1 {
-		return ProjectResponse{}, errors.New("再等等吧, 不让抓了")
+		return ProjectResponse{}, newServerError(res.StatusCode, result.Code, "再等等吧, 不让抓了", result.Extra.RequestID).withKind(ErrRateLimited)
+	}
+	if result.Code == 0 {
+		c.cache.Set(cacheKey, result, cache.Meta{URL: c.baseURL + "/serv/v3/learn/product"})
 	}
 
 	return result, nil
@@ -934,6 +953,15 @@ type Video struct {
 	} `json:"ld"`
 }
 
+// Subtitle 视频字幕, 对应 Subtitles 里面的元素, 字幕内容可能直接在 content 里, 也可能需要从 url 下载
+type Subtitle struct {
+	Lang     string `json:"lang"`
+	Language string `json:"language"`
+	Name     string `json:"name"`
+	URL      string `json:"url"`
+	Content  string `json:"content"`
+}
+
 type ArticleResponse struct {
 	Data struct {
 		TextReadVersion int           `json:"text_read_version"`
@@ -1050,26 +1078,33 @@ type ArticleResponse struct {
 	Code int `json:"code"`
 }
 
-func DeleteCache(key string) {
-	c.Delete(key)
+// DeleteCache 离线模式下缓存是唯一的数据来源, 不会删除
+func (c *client) DeleteCache(key string) {
+	if c.offline {
+		return
+	}
+	c.cache.Delete(key)
 }
 
-func DeleteArticleCache(id string) {
-	DeleteCache("article-" + id)
+func (c *client) DeleteArticleCache(id string) {
+	c.DeleteCache("article-" + id)
 }
 
 // Article 获取cid
-func Article(id string) (ArticleResponse, error) {
+func (c *client) Article(id string) (ArticleResponse, error) {
 	var result ArticleResponse
-	file, err := c.Get("article-" + id)
+	file, err := c.cached("article-" + id)
 	if err == nil && len(file) > 0 {
 		err = json.NewDecoder(bytes.NewReader(file)).Decode(&result)
 		if err == nil {
 			return result, err
 		}
 	}
+	if c.offline && errors.Is(err, cache.ErrCorrupt) {
+		return ArticleResponse{}, err
+	}
 
-	res, err := HttpClient.Post("https://time.geekbang.org/serv/v1/article", fmt.Sprintf(`{"id":"%s","include_neighbors":true,"is_freelyread":true}`, id), false)
+	res, err := c.Post(c.baseURL+"/serv/v1/article", fmt.Sprintf(`{"id":"%s","include_neighbors":true,"is_freelyread":true}`, id), false)
 	if err != nil {
 		return ArticleResponse{}, err
 	}
@@ -1083,7 +1118,7 @@ func Article(id string) (ArticleResponse, error) {
 	}
 
 	if res.StatusCode < 400 {
-		c.Set("article-"+id, result)
+		c.cache.Set("article-"+id, result, cache.Meta{URL: c.baseURL + "/serv/v1/article", Course: result.Data.Cid})
 	}
 
 	return result, nil
@@ -1169,25 +1204,72 @@ type ArticlesResponse struct {
 	Code int `json:"code"`
 }
 
-func DeleteArticlesCache(cid int) {
+func (c *client) DeleteArticlesCache(cid int) {
 	key := fmt.Sprintf("articles-%d", cid)
-	DeleteCache(key)
+	c.DeleteCache(key)
 }
 
-func Articles(cid int) (ArticlesResponse, error) {
+// Articles 按 score 游标翻页获取课程的全部文章, 直到 page.more 为 false
+func (c *client) Articles(cid int) (ArticlesResponse, error) {
 	var result ArticlesResponse
-	file, err := c.Get(fmt.Sprintf("articles-%d", cid))
+	file, err := c.cached(fmt.Sprintf("articles-%d", cid))
 	if err == nil && len(file) > 0 {
 		err = json.NewDecoder(bytes.NewReader(file)).Decode(&result)
 		if err == nil {
 			return result, err
 		}
 	}
-	res, err := HttpClient.Post("https://time.geekbang.org/serv/v1/column/articles",
-		fmt.Sprintf(`{"cid":%d,"size":500,"prev":0,"order":"earliest","sample":false}`, cid), false)
-	if err != nil {
+	if c.offline && errors.Is(err, cache.ErrCorrupt) {
 		return ArticlesResponse{}, err
 	}
+
+	var (
+		prev int64
+		seen = map[int]bool{}
+	)
+	for {
+		page, err := c.articlesPage(cid, prev)
+		if err != nil {
+			return ArticlesResponse{}, err
+		}
+		result.Code = page.Code
+		result.Data.Page.Count = page.Data.Page.Count
+		var added int
+		for _, item := range page.Data.List {
+			if seen[item.ID] {
+				continue
+			}
+			seen[item.ID] = true
+			result.Data.List = append(result.Data.List, item)
+			added++
+		}
+		if !page.Data.Page.More {
+			break
+		}
+		// 服务端如果一直返回重复的数据, 也要停下来
+		if added == 0 {
+			c.logger.Printf("[Articles]: 课程 %d 服务端还有更多文章, 但是 prev=%d 没有返回新的文章, 停止翻页\n", cid, prev)
+			break
+		}
+		prev = page.Data.List[len(page.Data.List)-1].Score
+	}
+
+	if result.Data.Page.Count > 0 && len(result.Data.List) != result.Data.Page.Count {
+		// 数量对不上时不缓存, 下次重新获取
+		c.logger.Printf("[Articles]: 课程 %d 服务端共有 %d 篇文章, 实际获取到 %d 篇\n", cid, result.Data.Page.Count, len(result.Data.List))
+		return result, nil
+	}
+	c.cache.Set(fmt.Sprintf("articles-%d", cid), result, cache.Meta{URL: c.baseURL + "/serv/v1/column/articles", Course: cid})
+	return result, nil
+}
+
+func (c *client) articlesPage(cid int, prev int64) (*ArticlesResponse, error) {
+	var result ArticlesResponse
+	res, err := c.Post(c.baseURL+"/serv/v1/column/articles",
+		fmt.Sprintf(`{"cid":%d,"size":500,"prev":%d,"order":"earliest","sample":false}`, cid, prev), false)
+	if err != nil {
+		return nil, err
+	}
 	defer func() {
 		io.Copy(io.Discard, res.Body)
 		res.Body.Close()
@@ -1195,36 +1277,57 @@ func Articles(cid int) (ArticlesResponse, error) {
 	all, _ := io.ReadAll(res.Body)
 	err = json.NewDecoder(bytes.NewReader(all)).Decode(&result)
 	if err != nil {
-		log.Println(string(all), cid)
-		return ArticlesResponse{}, err
+		c.logger.Println(string(all), cid)
+		return nil, err
 	}
-
-	if res.StatusCode < 400 {
-		c.Set(fmt.Sprintf("articles-%d", cid), result)
+	// 出错时 list 为空, 不能当成最后一页
+	if result.Code != 0 {
+		return nil, newServerError(res.StatusCode, result.Code, fmt.Sprintf("课程 %d 获取文章列表出错", cid), requestID(res, nil))
 	}
-	return result, nil
+	return &result, nil
 }
 
-func VideoKey(u string, vid string) ([]byte, error) {
+func (c *client) VideoKey(u string, vid string) ([]byte, error) {
 	cacheKey := "keyurl-" + vid
-	file, err := c.Get(cacheKey)
+	file, err := c.cached(cacheKey)
 	if err == nil {
 		return file, nil
 	}
-	request, _ := http.NewRequest("GET", u, nil)
-	request.Header.Set("origin", "https://time.geekbang.org")
-
-	get, err := (&http.Client{}).Do(request)
+	if c.offline {
+		if errors.Is(err, cache.ErrCorrupt) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %s", ErrOffline, u)
+	}
+	var (
+		get *http.Response
+		all []byte
+	)
+	limiter := c.limits.ForURL(u, waiter.ClassKey)
+	err = retry.Do(u, func() error {
+		request, _ := http.NewRequest("GET", u, nil)
+		request.Header.Set("origin", "https://time.geekbang.org")
+		limiter.Wait(context.TODO())
+		defer limiter.Release()
+		get, err = c.c.Do(request)
+		if err != nil {
+			return err
+		}
+		defer get.Body.Close()
+		if get.StatusCode >= 500 {
+			return &retry.StatusError{URL: u, StatusCode: get.StatusCode}
+		}
+		all, err = io.ReadAll(get.Body)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
-	defer get.Body.Close()
-	all, _ := io.ReadAll(get.Body)
 	if get.ContentLength > 0 {
-		c.SetOrigin(cacheKey, all)
+		c.cache.SetOrigin(cacheKey, all, cache.Meta{URL: u})
 	}
 	if get.StatusCode != 200 {
-		log.Printf("video key response code != 200, data: '%s', code: %d\n", string(all), get.StatusCode)
+		c.logger.Printf("video key response code != 200, data: '%s', code: %d\n", string(all), get.StatusCode)
 	}
 	return all, nil
 }
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// articlesServer 每页 2 篇, 共 5 篇, failAt 页返回 code -1, ignorePrev 时总是返回第一页
+type articlesServer struct {
+	requests   int
+	failAt     int
+	ignorePrev bool
+}
+
+func (s *articlesServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.requests++
+	var req struct {
+		Prev int `json:"prev"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+	if s.requests == s.failAt {
+		fmt.Fprint(w, `{"code":-1,"data":{"list":[],"page":{"count":0,"more":false}}}`)
+		return
+	}
+	start := req.Prev
+	if s.ignorePrev {
+		start = 0
+	}
+	var items []string
+	for id := start + 1; id <= start+2 && id <= 5; id++ {
+		items = append(items, fmt.Sprintf(`{"id":%d,"score":%d,"article_title":"第 %d 讲"}`, id, id, id))
+	}
+	fmt.Fprintf(w, `{"code":0,"data":{"list":[%s],"page":{"count":5,"more":%v}}}`, strings.Join(items, ","), start+2 < 5)
+}
+
+func newArticlesClient(t *testing.T, s *articlesServer) (*client, *bytes.Buffer) {
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	logs := &bytes.Buffer{}
+	return NewClient(WithBaseURL(srv.URL), WithLogger(log.New(logs, "", 0))).(*client), logs
+}
+
+func TestArticlesPaging(t *testing.T) {
+	s := &articlesServer{}
+	c, _ := newArticlesClient(t, s)
+	res, err := c.Articles(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Data.List) != 5 || res.Data.List[4].ID != 5 || s.requests != 3 {
+		t.Fatalf("got %d articles in %d requests", len(res.Data.List), s.requests)
+	}
+	// 完整的结果会被缓存
+	if _, err := c.Articles(1); err != nil || s.requests != 3 {
+		t.Errorf("second call: err = %v, requests = %d", err, s.requests)
+	}
+}
+
+func TestArticlesErrorPage(t *testing.T) {
+	s := &articlesServer{failAt: 2}
+	c, _ := newArticlesClient(t, s)
+	if _, err := c.Articles(1); err == nil {
+		t.Fatal("an error page must not be treated as the last page")
+	}
+	if _, err := c.cached("articles-1"); err == nil {
+		t.Error("partial result should not be cached")
+	}
+}
+
+func TestArticlesNoProgress(t *testing.T) {
+	s := &articlesServer{ignorePrev: true}
+	c, logs := newArticlesClient(t, s)
+	res, err := c.Articles(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Data.List) != 2 || s.requests != 2 {
+		t.Errorf("got %d articles in %d requests", len(res.Data.List), s.requests)
+	}
+	if !strings.Contains(logs.String(), "停止翻页") {
+		t.Errorf("stopping while the server reports more should be logged: %q", logs)
+	}
+	if _, err := c.cached("articles-1"); err == nil {
+		t.Error("partial result should not be cached")
+	}
+}
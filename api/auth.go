@@ -0,0 +1,69 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+)
+
+// SetRefresher 登录过期时优先调用 fn 恢复登录态(比如重新加载保存的 session), 失败后再用手机号密码重新登录
+func (c *client) SetRefresher(fn func() error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.refresher = fn
+}
+
+func (c *client) authGeneration() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.authGen
+}
+
+// replay 请求返回未登录时重新登录, 然后把请求重放一次
+func (c *client) replay(direct bool, do func() error) error {
+	gen := c.authGeneration()
+	err := do()
+	if direct || !errors.Is(err, ErrUnauthorized) {
+		return err
+	}
+	if e := c.reauth(gen); e != nil {
+		return fmt.Errorf("%w, 重新登录失败: %v", err, e)
+	}
+	return do()
+}
+
+// reauth 暂停所有请求直到重新登录完成, 并发的请求只会触发一次登录,
+// gen 已经过期说明其他请求已经重新登录过了, 直接重放即可
+func (c *client) reauth(gen int) error {
+	_, err, _ := c.sf.Do("reauth", func() (interface{}, error) {
+		if c.authGeneration() != gen {
+			return nil, nil
+		}
+		rt := c.limiter()
+		rt.Stw()
+		defer rt.Restart()
+		c.logger.Println("登录已过期, 正在重新登录")
+
+		c.mu.RLock()
+		refresher := c.refresher
+		c.mu.RUnlock()
+
+		var err error = ErrUnauthorized
+		if refresher != nil {
+			if err = refresher(); err != nil {
+				c.logger.Println("恢复登录态失败:", err)
+			}
+		}
+		if err != nil && c.phone != "" && c.password != "" {
+			_, err = c.Login(c.phone, c.password)
+		}
+		if err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		c.authGen++
+		c.mu.Unlock()
+		c.logger.Println("重新登录成功")
+		return nil, nil
+	})
+	return err
+}
@@ -1,35 +1,40 @@
 package api
 
 import (
-	"log"
 	"net/http"
-	"time"
 
-	"github.com/cenkalti/backoff/v4"
+	"github.com/duc-cnzj/geekbang2md/retry"
+	"github.com/duc-cnzj/geekbang2md/transport"
 )
 
+// BackoffClient 使用 retry.Default 的策略, 最多重试 RetryTimes 次, 5xx 也会重试,
+// RetryTimes 为 0 时和其他请求一样使用 retry.Default 的次数(-retry 参数)
 type BackoffClient struct {
 	RetryTimes uint64
 	c          *http.Client
 }
 
 func NewBackoffClient(retryTimes uint64) *BackoffClient {
-	return &BackoffClient{RetryTimes: retryTimes, c: &http.Client{}}
+	return &BackoffClient{RetryTimes: retryTimes, c: transport.NewClient()}
 }
 
 func (b *BackoffClient) Get(u string) (*http.Response, error) {
-	var (
-		resp *http.Response
-		err  error
-	)
-	if err = backoff.Retry(func() (e error) {
-		resp, e = b.c.Get(u)
-		if e != nil {
-			log.Printf("http '%s' err: '%v'  , retry...\n", u, e)
+	var resp *http.Response
+	policy := retry.Default
+	if b.RetryTimes > 0 {
+		policy = retry.Default.WithMaxAttempts(int(b.RetryTimes) + 1)
+	}
+	if err := policy.Do(u, func() (e error) {
+		if resp, e = b.c.Get(u); e != nil {
+			return e
+		}
+		if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+			resp.Body.Close()
+			return &retry.StatusError{URL: u, StatusCode: resp.StatusCode}
 		}
-		return e
-	}, backoff.WithMaxRetries(backoff.NewConstantBackOff(3*time.Second), b.RetryTimes)); err != nil {
+		return nil
+	}); err != nil {
 		return nil, err
 	}
-	return resp, err
+	return resp, nil
 }
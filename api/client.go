@@ -0,0 +1,163 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/duc-cnzj/geekbang2md/cache"
+	"github.com/duc-cnzj/geekbang2md/waiter"
+)
+
+const (
+	// DefaultBaseURL 极客时间接口地址
+	DefaultBaseURL = "https://time.geekbang.org"
+	// DefaultAccountURL 登录、短信验证码、用户信息接口地址
+	DefaultAccountURL = "https://account.geekbang.org"
+	// DefaultTokenURL 用 ticket 换取登录 cookie 的接口地址
+	DefaultTokenURL = "https://account.infoq.cn"
+)
+
+// Client 极客时间接口, 方便嵌入到其他程序或者在测试中替换
+type Client interface {
+	Login(cellphone, password string) (*AuthInfo, error)
+	UserAuth(t int) (*AuthInfo, error)
+	Products(prev, size int, t PType) (ProjectResponse, error)
+	Articles(cid int) (ArticlesResponse, error)
+	Article(id string) (ArticleResponse, error)
+	Skus(p PType) (*SkusResponse, error)
+	Infos(chunks IntString) (*InfosResponse, error)
+	VideoKey(u string, vid string) ([]byte, error)
+}
+
+// Cache 接口响应的缓存, 默认使用 cache.Cache, 过期的缓存 Get 时返回 cache.ErrExpired
+type Cache interface {
+	Get(key string) ([]byte, error)
+	Set(key string, data interface{}, meta cache.Meta) error
+	SetOrigin(key string, data []byte, meta cache.Meta) error
+	Delete(key string) error
+}
+
+type Option func(*client)
+
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *client) {
+		c.c = hc
+	}
+}
+
+func WithCache(cache Cache) Option {
+	return func(c *client) {
+		c.cache = cache
+	}
+}
+
+func WithLimiter(rt waiter.Interface) Option {
+	return func(c *client) {
+		c.rt = rt
+	}
+}
+
+func WithLogger(logger *log.Logger) Option {
+	return func(c *client) {
+		c.logger = logger
+	}
+}
+
+// WithBaseURL 替换 https://time.geekbang.org, 账号相关的接口使用 WithAccountURL
+func WithBaseURL(u string) Option {
+	return func(c *client) {
+		c.baseURL = strings.TrimRight(u, "/")
+	}
+}
+
+// WithAccountURL 替换 https://account.geekbang.org 和 https://account.infoq.cn,
+// 和 WithBaseURL 一起使用可以把所有请求都指向测试服务器
+func WithAccountURL(u string) Option {
+	return func(c *client) {
+		c.accountURL = strings.TrimRight(u, "/")
+		c.tokenURL = c.accountURL
+	}
+}
+
+// WithCookies 使用已有的登录态, 比如从浏览器导出的 cookie, 在其他选项之后生效,
+// 没有 Domain 的 cookie 对 WithBaseURL 所在的主域名生效
+func WithCookies(cookies []*http.Cookie) Option {
+	return func(c *client) {
+		c.initCookies = append(c.initCookies, cookies...)
+	}
+}
+
+// WithHeaders 每个请求都会带上的额外 header
+func WithHeaders(headers map[string]string) Option {
+	return func(c *client) {
+		c.SetHeaders(headers)
+	}
+}
+
+// WithOffline 只使用缓存, 没有缓存时返回 ErrOffline
+func WithOffline() Option {
+	return func(c *client) {
+		c.offline = true
+	}
+}
+
+// NewClient 创建一个独立的客户端, 每个客户端有自己的 cookie、限流和缓存,
+// 缓存默认只保存在内存中, 需要持久化时使用 WithCache
+func NewClient(opts ...Option) Client {
+	limits := waiter.NewRegistry(waiter.DefaultLimits)
+	defaults := []Option{
+		func(c *client) {
+			c.limits = limits
+		},
+		WithCache(&cache.Cache{Store: cache.NewMemoryStore()}),
+	}
+	return newClient(append(defaults, opts...)...)
+}
+
+var _ Client = (*client)(nil)
+
+func Infos(chunks IntString) (*InfosResponse, error) {
+	return HttpClient.Infos(chunks)
+}
+
+func Skus(p PType) (*SkusResponse, error) {
+	return HttpClient.Skus(p)
+}
+
+func AllProducts(t PType) ([]Product, error) {
+	return HttpClient.AllProducts(t)
+}
+
+func Products(prev, size int, t PType) (ProjectResponse, error) {
+	return HttpClient.Products(prev, size, t)
+}
+
+func DeleteCache(key string) {
+	HttpClient.DeleteCache(key)
+}
+
+func DeleteArticleCache(id string) {
+	HttpClient.DeleteArticleCache(id)
+}
+
+func Article(id string) (ArticleResponse, error) {
+	return HttpClient.Article(id)
+}
+
+func DeleteArticlesCache(cid int) {
+	HttpClient.DeleteArticlesCache(cid)
+}
+
+func Articles(cid int) (ArticlesResponse, error) {
+	return HttpClient.Articles(cid)
+}
+
+func VideoKey(u string, vid string) ([]byte, error) {
+	return HttpClient.VideoKey(u, vid)
+}
+
+// Offline 是否是离线模式, 离线模式下已经存在的文档也会重新生成
+func Offline() bool {
+	return HttpClient.Offline()
+}
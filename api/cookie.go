@@ -0,0 +1,100 @@
+package api
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// cookieStore 请求时使用标准库的 cookiejar 按域名、路径匹配 cookie,
+// cookiejar 没办法导出, 所以另外记录一份用来持久化登录态。
+// 实现了 http.CookieJar, 下载图片、视频时和接口共用同一份登录态
+type cookieStore struct {
+	mu      sync.Mutex
+	jar     *cookiejar.Jar
+	records map[string]*http.Cookie
+}
+
+func newCookieStore() *cookieStore {
+	s := &cookieStore{}
+	s.reset()
+	return s
+}
+
+// reset 清空所有 cookie, 已经拿到这个 jar 的 http.Client 也会跟着清空
+func (s *cookieStore) reset() {
+	jar, _ := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jar = jar
+	s.records = map[string]*http.Cookie{}
+}
+
+func (s *cookieStore) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	s.set(u, cookies, "")
+}
+
+func (s *cookieStore) Cookies(u *url.URL) []*http.Cookie {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.jar.Cookies(u)
+}
+
+// set u 为空时使用 cookie 自己的 Domain, 没有 Domain 的 cookie 属于 defaultDomain 及其子域名
+func (s *cookieStore) set(u *url.URL, cookies []*http.Cookie, defaultDomain string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for _, c := range cookies {
+		if c == nil || c.Name == "" {
+			continue
+		}
+		cp := *c
+		target := u
+		if target == nil {
+			if cp.Domain == "" {
+				cp.Domain = defaultDomain
+			}
+			target = &url.URL{Scheme: "https", Host: strings.TrimPrefix(cp.Domain, "."), Path: "/"}
+		}
+		s.jar.SetCookies(target, []*http.Cookie{&cp})
+
+		if cp.Domain == "" {
+			cp.Domain = target.Hostname()
+		}
+		if cp.Path == "" {
+			cp.Path = "/"
+		}
+		key := strings.TrimPrefix(strings.ToLower(cp.Domain), ".") + ";" + cp.Path + ";" + cp.Name
+		if cp.MaxAge < 0 || (!cp.Expires.IsZero() && cp.Expires.Before(now)) {
+			delete(s.records, key)
+			continue
+		}
+		if cp.MaxAge > 0 {
+			cp.Expires = now.Add(time.Duration(cp.MaxAge) * time.Second)
+			cp.MaxAge = 0
+		}
+		s.records[key] = &cp
+	}
+}
+
+// all 所有没过期的 cookie, 带有 Domain, 可以直接传给 set 恢复
+func (s *cookieStore) all() []*http.Cookie {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	res := make([]*http.Cookie, 0, len(s.records))
+	for _, c := range s.records {
+		if !c.Expires.IsZero() && c.Expires.Before(now) {
+			continue
+		}
+		cp := *c
+		res = append(res, &cp)
+	}
+	return res
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/duc-cnzj/geekbang2md/downloader"
+	"github.com/duc-cnzj/geekbang2md/transport"
+)
+
+// 接口刷新的 cookie, 下载器马上就能用上
+func TestJarSharedWithDownloader(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		sent []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/serv/v1/refresh":
+			http.SetCookie(w, &http.Cookie{Name: "GCESS", Value: "refreshed", Path: "/"})
+			fmt.Fprint(w, `{"code":0,"data":{}}`)
+		default:
+			c, _ := r.Cookie("GCESS")
+			mu.Lock()
+			if c != nil {
+				sent = append(sent, c.Value)
+			} else {
+				sent = append(sent, "")
+			}
+			mu.Unlock()
+			fmt.Fprint(w, "file")
+		}
+	}))
+	defer srv.Close()
+
+	c := NewClient(WithBaseURL(srv.URL), WithAccountURL(srv.URL), WithLimiter(&fakeLimiter{}), WithLogger(log.New(io.Discard, "", 0))).(*client)
+	c.SetCookies([]*http.Cookie{{Name: "GCESS", Value: "login"}})
+	d := downloader.New(transport.NewClient())
+	d.SetCookieJar(c.Jar())
+
+	dir := t.TempDir()
+	download := func(name string) {
+		t.Helper()
+		if _, err := d.Download(srv.URL+"/media/"+name, filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	download("1.jpg")
+
+	res, err := c.Get(srv.URL+"/serv/v1/refresh", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	download("2.jpg")
+
+	// 退出登录后下载器也不再带上旧的 cookie
+	c.ClearCookies()
+	download("3.jpg")
+
+	mu.Lock()
+	defer mu.Unlock()
+	if got := fmt.Sprintf("%q", sent); got != `["login" "refreshed" ""]` {
+		t.Errorf("downloader sent GCESS = %s", got)
+	}
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/duc-cnzj/geekbang2md/transport"
+)
+
+var (
+	// ErrRateLimited 请求太频繁, 被限流了 (451/452/429)
+	ErrRateLimited = errors.New("geekbang: 请求太频繁了")
+	// ErrUnauthorized 没有登录或者登录已经过期
+	ErrUnauthorized = errors.New("geekbang: 未登录或登录已过期")
+	// ErrNotPurchased 没有购买该课程
+	ErrNotPurchased = errors.New("geekbang: 未购买该课程")
+	// ErrCaptchaRequired 登录需要验证码
+	ErrCaptchaRequired = errors.New("geekbang: 需要验证码")
+	// ErrOffline 离线模式下需要的数据没有缓存, 和 transport.ErrOffline 是同一个错误,
+	// 不管是 api 还是下载图片、音频时返回的都可以用它判断
+	ErrOffline = transport.ErrOffline
+	// ErrServer 所有 *ServerError 都满足 errors.Is(err, ErrServer)
+	ErrServer = errors.New("geekbang: 接口返回错误")
+)
+
+// ServerError 极客时间接口返回的错误, 可以用 errors.Is 判断具体是哪一类
+type ServerError struct {
+	StatusCode int
+	Code       int
+	Msg        string
+	RequestID  string
+
+	kind error
+}
+
+func (e *ServerError) Error() string {
+	msg := e.Msg
+	if msg == "" {
+		msg = e.kind.Error()
+	}
+	return fmt.Sprintf("%s (status: %d, code: %d, request-id: %s)", msg, e.StatusCode, e.Code, e.RequestID)
+}
+
+func (e *ServerError) Unwrap() error {
+	return e.kind
+}
+
+func (e *ServerError) Is(target error) bool {
+	return target == ErrServer
+}
+
+// newServerError 根据状态码和错误信息推断错误类型, 无法识别时为 ErrServer
+func newServerError(statusCode, code int, msg, requestID string) *ServerError {
+	e := &ServerError{StatusCode: statusCode, Code: code, Msg: msg, RequestID: requestID, kind: ErrServer}
+	switch {
+	case statusCode == 451 || statusCode == 452 || statusCode == http.StatusTooManyRequests:
+		e.kind = ErrRateLimited
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		e.kind = ErrUnauthorized
+	case strings.Contains(msg, "验证码") || strings.Contains(strings.ToLower(msg), "captcha"):
+		e.kind = ErrCaptchaRequired
+	case strings.Contains(msg, "登录") || strings.Contains(strings.ToLower(msg), "login"):
+		e.kind = ErrUnauthorized
+	case strings.Contains(msg, "购买") || strings.Contains(msg, "订阅"):
+		e.kind = ErrNotPurchased
+	}
+	return e
+}
+
+// Retryable 被限流(已经暂停过)以及 5xx 可以重试, 登录失效、未购买等不重试
+func (e *ServerError) Retryable() bool {
+	return e.kind == ErrRateLimited || (e.kind == ErrServer && e.StatusCode >= 500)
+}
+
+func (e *ServerError) withKind(kind error) *ServerError {
+	e.kind = kind
+	return e
+}
+
+type GKError struct {
+	Error struct {
+		Msg  string `json:"msg"`
+		Code int    `json:"code"`
+	} `json:"error"`
+	// Extra 成功时是 [], 出错时是 {"cost":..., "request-id":...}
+	Extra json.RawMessage `json:"extra"`
+}
+
+func (e *GKError) RequestID() string {
+	var extra struct {
+		RequestID string `json:"request-id"`
+	}
+	json.Unmarshal(e.Extra, &extra)
+	return extra.RequestID
+}
+
+// parseGKError 解析响应体中的 error 字段, 没有错误时返回 nil
+func parseGKError(res *http.Response, body []byte) *ServerError {
+	e := &GKError{}
+	if err := json.Unmarshal(body, e); err != nil || e.Error.Code >= 0 {
+		return nil
+	}
+	return newServerError(res.StatusCode, e.Error.Code, e.Error.Msg, requestID(res, e))
+}
+
+func requestID(res *http.Response, e *GKError) string {
+	if e != nil {
+		if id := e.RequestID(); id != "" {
+			return id
+		}
+	}
+	return res.Header.Get("X-Request-Id")
+}
@@ -9,35 +9,72 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"strconv"
-	"strings"
 	"sync"
 	"time"
 
-	"github.com/cenkalti/backoff/v4"
+	"golang.org/x/net/publicsuffix"
 
-	"github.com/duc-cnzj/geekbang2md/constant"
+	"github.com/duc-cnzj/geekbang2md/cache"
+	"github.com/duc-cnzj/geekbang2md/retry"
+	"github.com/duc-cnzj/geekbang2md/transport"
 	"github.com/duc-cnzj/geekbang2md/utils"
 	"github.com/duc-cnzj/geekbang2md/waiter"
 )
 
-var sf utils.Group
-
+// HttpClient 默认的客户端, 包级别的 Articles/Article 等方法都使用它,
+// 和图片、视频下载共用 waiter.Default 以及 cache 包的默认存储
 var HttpClient = newClient()
 
 type client struct {
 	mu      sync.RWMutex
-	cookies []*http.Cookie
+	cookies *cookieStore
 	headers map[string]string
 
 	c               *http.Client
 	rt              waiter.Interface
+	limits          *waiter.Registry
+	cache           Cache
+	logger          *log.Logger
+	baseURL         string
+	accountURL      string
+	tokenURL        string
+	initCookies     []*http.Cookie
+	sf              utils.Group
 	phone, password string
+
+	// refresher 登录过期时用来恢复登录态, authGen 每重新登录一次加一
+	refresher func() error
+	authGen   int
+
+	// offline 不发起请求, 只使用缓存(包括已过期的)
+	offline bool
 }
 
-func newClient() *client {
-	return &client{c: &http.Client{}, rt: waiter.NewWaiter(constant.RequestLimit, constant.BucketSize), headers: map[string]string{}}
+func newClient(opts ...Option) *client {
+	c := &client{
+		c:          transport.NewClient(),
+		limits:     waiter.Default,
+		cache:      &cache.Cache{},
+		logger:     log.Default(),
+		baseURL:    DefaultBaseURL,
+		accountURL: DefaultAccountURL,
+		tokenURL:   DefaultTokenURL,
+		cookies:    newCookieStore(),
+		headers:    map[string]string{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	// cookie 的默认 Domain 取决于 baseURL, 所以放在最后
+	if len(c.initCookies) > 0 {
+		c.SetCookies(c.initCookies)
+		c.initCookies = nil
+	}
+	return c
 }
 
 func (c *client) SetPhone(phone string) {
@@ -48,6 +85,19 @@ func (c *client) SetPassword(pwd string) {
 }
 
 func (c *client) Get(url string, direct bool) (resp *http.Response, err error) {
+	if c.offline {
+		return nil, fmt.Errorf("%w: %s", ErrOffline, url)
+	}
+	err = c.replay(direct, func() error {
+		return retry.Do("GET "+url, func() error {
+			resp, err = c.get(url, direct)
+			return err
+		})
+	})
+	return resp, err
+}
+
+func (c *client) get(url string, direct bool) (resp *http.Response, err error) {
 	r, _ := http.NewRequest("GET", url, nil)
 	c.addHeaders(r)
 
@@ -60,6 +110,7 @@ func (c *client) Get(url string, direct bool) (resp *http.Response, err error) {
 	if err != nil {
 		return nil, err
 	}
+	c.saveCookies(do)
 	do, err = c.handleError(do, false)
 	if err != nil {
 		return nil, err
@@ -80,32 +131,42 @@ func (c *client) Get(url string, direct bool) (resp *http.Response, err error) {
 }
 
 func (c *client) Post(url string, data interface{}, direct bool) (resp *http.Response, err error) {
-	var body io.Reader
+	if c.offline {
+		return nil, fmt.Errorf("%w: %s", ErrOffline, url)
+	}
+	var body []byte
 	switch d := data.(type) {
 	case string:
-		body = strings.NewReader(d)
+		body = []byte(d)
 	default:
-		marshal, _ := json.Marshal(data)
-		body = bytes.NewReader(marshal)
+		body, _ = json.Marshal(data)
 	}
-	r, err := http.NewRequest("POST", url, body)
+	err = c.replay(direct, func() error {
+		return retry.Do("POST "+url, func() error {
+			resp, err = c.post(url, body, direct)
+			return err
+		})
+	})
+	return resp, err
+}
+
+func (c *client) post(url string, body []byte, direct bool) (resp *http.Response, err error) {
+	r, err := http.NewRequest("POST", url, bytes.NewReader(body))
 	if err != nil {
-		return nil, err
+		return nil, retry.Permanent(err)
 	}
 	c.addHeaders(r)
 
 	var do *http.Response
-	backoff.Retry(func() (e error) {
-		if direct {
-			do, err = c.c.Do(r)
-		} else {
-			do, err = c.Do(r)
-		}
-		return err
-	}, backoff.WithMaxRetries(backoff.NewConstantBackOff(3*time.Second), 3))
+	if direct {
+		do, err = c.c.Do(r)
+	} else {
+		do, err = c.Do(r)
+	}
 	if err != nil {
 		return nil, err
 	}
+	c.saveCookies(do)
 	do, err = c.handleError(do, direct)
 	if err != nil {
 		return nil, err
@@ -121,12 +182,14 @@ func (c *client) Post(url string, data interface{}, direct bool) (resp *http.Res
 		do.Body = reader
 	default:
 	}
-	all, _ := io.ReadAll(do.Body)
-	e := &GKError{}
-	json.Unmarshal(all, &e)
-	if e != nil && e.Error.Code < 0 {
+	all, err := io.ReadAll(do.Body)
+	if err != nil {
 		do.Body.Close()
-		return nil, fmt.Errorf("%v %d", e.Error.Msg, e.Error.Code)
+		return nil, err
+	}
+	if e := parseGKError(do, all); e != nil {
+		do.Body.Close()
+		return nil, e
 	}
 	do.Body = io.NopCloser(bytes.NewBuffer(all))
 
@@ -134,16 +197,52 @@ func (c *client) Post(url string, data interface{}, direct bool) (resp *http.Res
 }
 
 func (c *client) Do(req *http.Request) (*http.Response, error) {
-	c.rt.Wait(context.TODO())
-	defer c.rt.Release()
-	return c.c.Do(req)
+	rt := c.limiter()
+	rt.Wait(context.TODO())
+	defer rt.Release()
+	res, err := c.c.Do(req)
+	if f, ok := rt.(waiter.Feedback); ok && err == nil && res.StatusCode < 400 {
+		f.Success()
+	}
+	return res, err
+}
+
+// SetOffline 需要在发起请求之前调用
+func (c *client) SetOffline(offline bool) {
+	c.offline = offline
+}
+
+func (c *client) Offline() bool {
+	return c.offline
+}
+
+// cached 过期的缓存只在离线模式下使用
+func (c *client) cached(key string) ([]byte, error) {
+	file, err := c.cache.Get(key)
+	if c.offline && errors.Is(err, cache.ErrExpired) {
+		err = nil
+	}
+	return file, err
+}
+
+// SetLimiter 需要在发起请求之前调用, 不设置时使用 limits 中 baseURL 对应的 api 限流器
+func (c *client) SetLimiter(rt waiter.Interface) {
+	c.rt = rt
+}
+
+// limiter 每次请求时再从 limits 中获取, -limits 参数解析之后修改的配置才能生效
+func (c *client) limiter() waiter.Interface {
+	if c.rt != nil {
+		return c.rt
+	}
+	return c.limits.ForURL(c.baseURL, waiter.ClassAPI)
 }
 
 func (c *client) Login(cellphone, password string) (*AuthInfo, error) {
-	c.SetCookies(nil)
-	u, err, shared := sf.Do("login", func() (interface{}, error) {
+	c.ClearCookies()
+	u, err, shared := c.sf.Do("login", func() (interface{}, error) {
 		var user *AuthInfo
-		post, err := c.Post("https://account.geekbang.org/account/ticket/login", map[string]interface{}{
+		post, err := c.Post(c.accountURL+"/account/ticket/login", map[string]interface{}{
 			"country":   86,
 			"cellphone": cellphone,
 			"password":  password,
@@ -157,10 +256,6 @@ func (c *client) Login(cellphone, password string) (*AuthInfo, error) {
 			return nil, err
 		}
 		defer post.Body.Close()
-		if err != nil {
-			return nil, err
-		}
-		c.SetCookies(post.Cookies())
 		ti, err := c.Time()
 		if err != nil {
 			return nil, err
@@ -168,11 +263,11 @@ func (c *client) Login(cellphone, password string) (*AuthInfo, error) {
 		if user, err = c.UserAuth(ti.Data * 1000); err != nil {
 			return nil, err
 		}
-		log.Println("登录成功")
+		c.logger.Println("登录成功")
 		return user, nil
 	})
 	if shared {
-		log.Println("login request shared.")
+		c.logger.Println("login request shared.")
 	}
 	if err != nil {
 		return nil, err
@@ -180,14 +275,13 @@ func (c *client) Login(cellphone, password string) (*AuthInfo, error) {
 	return u.(*AuthInfo), nil
 }
 func (c *client) Token(token string) error {
-	res, err := c.Post("https://account.infoq.cn/account/ticket/token", map[string]interface{}{
+	res, err := c.Post(c.tokenURL+"/account/ticket/token", map[string]interface{}{
 		"token": token,
 	}, true)
 	if err != nil {
 		return err
 	}
 	defer res.Body.Close()
-	c.SetCookies(res.Cookies())
 	return nil
 }
 
@@ -198,14 +292,13 @@ type TimeResponse struct {
 
 func (c *client) Time() (*TimeResponse, error) {
 	var r *TimeResponse
-	res, err := c.Get("https://time.geekbang.org/serv/v1/time", true)
+	res, err := c.Get(c.baseURL+"/serv/v1/time", true)
 	if err != nil {
 		return nil, err
 	}
 	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
 		return nil, err
 	}
-	c.SetCookies(res.Cookies())
 	return r, nil
 }
 
@@ -230,37 +323,80 @@ type AuthInfo struct {
 }
 
 func (c *client) UserAuth(t int) (*AuthInfo, error) {
-	res, err := c.Get("https://account.geekbang.org/serv/v1/user/auth?t="+strconv.Itoa(t), true)
+	res, err := c.Get(c.accountURL+"/serv/v1/user/auth?t="+strconv.Itoa(t), true)
 	if err != nil {
 		return nil, err
 	}
 	defer res.Body.Close()
+	all, _ := io.ReadAll(res.Body)
 	info := &AuthInfo{}
-	json.NewDecoder(res.Body).Decode(&info)
+	json.Unmarshal(all, &info)
 	if info.Code != 0 {
-		return nil, fmt.Errorf("%v %d", info.Error, info.Code)
+		if e := parseGKError(res, all); e != nil {
+			if !errors.Is(e, ErrCaptchaRequired) {
+				e.withKind(ErrUnauthorized)
+			}
+			return nil, e
+		}
+		return nil, newServerError(res.StatusCode, info.Code, "", requestID(res, nil)).withKind(ErrUnauthorized)
 	}
-	c.SetCookies(res.Cookies())
 	return info, nil
 }
 
+// SetCookies 同名 cookie 会被替换, 没有 Domain 的 cookie 对 baseURL 所在的主域名生效
 func (c *client) SetCookies(cookies []*http.Cookie) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.cookies = append(c.cookies, cookies...)
+	c.cookies.set(nil, cookies, c.cookieDomain())
+}
+
+func (c *client) ClearCookies() {
+	c.cookies.reset()
+}
+
+// Cookies 当前登录态的 cookie, 用来持久化
+func (c *client) Cookies() []*http.Cookie {
+	return c.cookies.all()
+}
+
+// Jar 登录态所在的 cookie jar, 重新登录、ClearCookies 之后仍然是同一个,
+// 交给下载器使用就不用在每次登录后重新设置
+func (c *client) Jar() http.CookieJar {
+	return c.cookies
 }
 
+// saveCookies 按响应对应的请求地址保存 Set-Cookie
+func (c *client) saveCookies(res *http.Response) {
+	if res.Request == nil || res.Request.URL == nil {
+		return
+	}
+	c.cookies.set(res.Request.URL, res.Cookies(), "")
+}
+
+func (c *client) cookieDomain() string {
+	u, err := url.Parse(c.baseURL)
+	if err != nil {
+		return ""
+	}
+	// 测试服务器一般是 ip 地址, 没有主域名
+	if net.ParseIP(u.Hostname()) != nil {
+		return u.Hostname()
+	}
+	if d, err := publicsuffix.EffectiveTLDPlusOne(u.Hostname()); err == nil {
+		return "." + d
+	}
+	return u.Hostname()
+}
+
+// SetHeaders 合并到已有的 header 中, 值为空时删除该 header
 func (c *client) SetHeaders(m map[string]string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.headers = m
-}
-
-type GKError struct {
-	Error struct {
-		Msg  string `json:"msg"`
-		Code int    `json:"code"`
-	} `json:"error"`
+	for k, v := range m {
+		if v == "" {
+			delete(c.headers, k)
+			continue
+		}
+		c.headers[k] = v
+	}
 }
 
 func (c *client) addHeaders(r *http.Request) {
@@ -276,37 +412,52 @@ func (c *client) addHeaders(r *http.Request) {
 	r.Header.Add("Sec-Fetch-Mode", "cors")
 	r.Header.Add("Sec-Fetch-Site", "same-origin")
 	r.Header.Add("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/98.0.4758.109 Safari/537.36")
+	for _, cookie := range c.cookies.Cookies(r.URL) {
+		r.AddCookie(cookie)
+	}
 	func() {
 		c.mu.RLock()
 		defer c.mu.RUnlock()
-		for i := range c.cookies {
-			r.AddCookie(c.cookies[i])
-		}
 		for k, v := range c.headers {
-			r.Header.Add(k, v)
+			r.Header.Set(k, v)
 		}
 	}()
 }
 
 func (c *client) handleError(do *http.Response, direct bool) (*http.Response, error) {
-	if do.StatusCode == 451 || do.StatusCode == 452 {
+	if do.StatusCode == 451 || do.StatusCode == 452 || do.StatusCode == http.StatusTooManyRequests {
 		defer do.Body.Close()
 		if !direct {
-			c.rt.Stw()
-			time.Sleep(20 * time.Second)
+			rt := c.limiter()
+			rt.Stw()
+			d := 20 * time.Second
+			if f, ok := rt.(waiter.Feedback); ok {
+				d = f.Throttled()
+			}
+			c.logger.Printf("请求太频繁, 暂停 %s\n", d.Round(time.Second))
+			time.Sleep(d)
 			if c.phone != "" && c.password != "" {
 				if _, err := c.Login(c.phone, c.password); err != nil {
-					log.Fatalln("login err: ", err, c.phone, c.password)
+					rt.Restart()
+					// 不能返回 ErrUnauthorized, 否则 replay 会在限流期间再登录一次
+					if errors.Is(err, ErrCaptchaRequired) {
+						return nil, retry.Permanent(err)
+					}
+					msg := fmt.Sprintf("请求太频繁了, 重新登录失败: %v", err)
+					return nil, retry.Permanent(newServerError(do.StatusCode, 0, msg, requestID(do, nil)))
 				}
 			}
-			c.rt.Restart()
+			rt.Restart()
 		}
-		return nil, errors.New("geekbang 451: 请求太频繁了，程序虽然能继续运行，但还是建议你过会儿再下载")
+		return nil, newServerError(do.StatusCode, 0, "请求太频繁了，程序虽然能继续运行，但还是建议你过会儿再下载", requestID(do, nil))
 	}
 	if do.StatusCode > 400 {
 		defer do.Body.Close()
 		all, _ := io.ReadAll(do.Body)
-		return nil, fmt.Errorf("%d %v", do.StatusCode, all)
+		if e := parseGKError(do, all); e != nil {
+			return nil, e
+		}
+		return nil, newServerError(do.StatusCode, 0, string(all), requestID(do, nil))
 	}
 	return do, nil
 }
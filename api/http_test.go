@@ -0,0 +1,146 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/duc-cnzj/geekbang2md/retry"
+)
+
+// fakeLimiter 记录暂停/恢复的次数, Throttled 不真的等待
+type fakeLimiter struct {
+	mu                      sync.Mutex
+	stw, restart, throttled int
+}
+
+func (l *fakeLimiter) Wait(context.Context) {}
+func (l *fakeLimiter) Release()             {}
+func (l *fakeLimiter) Success()             {}
+func (l *fakeLimiter) Stw()                 { l.mu.Lock(); l.stw++; l.mu.Unlock() }
+func (l *fakeLimiter) Restart()             { l.mu.Lock(); l.restart++; l.mu.Unlock() }
+
+func (l *fakeLimiter) Throttled() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.throttled++
+	return time.Millisecond
+}
+
+// authServer /serv/v1/lesson 按 responses 的顺序返回状态码, 登录成功后才返回 200
+type authServer struct {
+	mu        sync.Mutex
+	responses []int
+	loginOK   bool
+	requests  []string
+}
+
+func (s *authServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, r.URL.Path)
+	switch r.URL.Path {
+	case "/account/ticket/login":
+		if !s.loginOK {
+			fmt.Fprint(w, `{"code":-1,"error":{"code":-3005,"msg":"密码错误"}}`)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "GCESS", Value: "new", Path: "/"})
+		fmt.Fprint(w, `{"code":0,"data":{}}`)
+	case "/serv/v1/time":
+		fmt.Fprint(w, `{"code":0,"data":1650000000}`)
+	case "/serv/v1/user/auth":
+		fmt.Fprint(w, `{"code":0,"data":{"uid":1}}`)
+	case "/serv/v1/lesson":
+		status := http.StatusOK
+		if len(s.responses) > 0 {
+			status, s.responses = s.responses[0], s.responses[1:]
+		}
+		if c, _ := r.Cookie("GCESS"); status == http.StatusOK && (c == nil || c.Value != "new") {
+			status = http.StatusUnauthorized
+		}
+		w.WriteHeader(status)
+		fmt.Fprint(w, `{"code":0,"data":"lesson"}`)
+	}
+}
+
+func (s *authServer) paths() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return strings.Join(s.requests, " ")
+}
+
+func newAuthClient(t *testing.T, s *authServer) (*client, *fakeLimiter, string) {
+	policy := retry.Default
+	retry.Default = &retry.Policy{MaxAttempts: 3, InitialInterval: time.Millisecond, MaxInterval: time.Millisecond, Multiplier: 1}
+	t.Cleanup(func() { retry.Default = policy })
+
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	rt := &fakeLimiter{}
+	c := NewClient(WithBaseURL(srv.URL), WithAccountURL(srv.URL), WithLimiter(rt), WithLogger(log.New(io.Discard, "", 0))).(*client)
+	c.SetPhone("13800000000")
+	c.SetPassword("password")
+	return c, rt, srv.URL + "/serv/v1/lesson"
+}
+
+// 登录过期: 重新登录后把请求重放一次
+func TestReplayAfterReauth(t *testing.T) {
+	s := &authServer{loginOK: true}
+	c, rt, u := newAuthClient(t, s)
+	res, err := c.Get(u, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if got := s.paths(); got != "/serv/v1/lesson /account/ticket/login /serv/v1/time /serv/v1/user/auth /serv/v1/lesson" {
+		t.Errorf("requests = %s", got)
+	}
+	if rt.stw != 1 || rt.restart != 1 {
+		t.Errorf("stw = %d, restart = %d, want requests paused once during re-login", rt.stw, rt.restart)
+	}
+}
+
+// 被限流: 暂停所有请求, 等待 Throttled 的时间后重新登录, 然后由 retry 重新请求
+func TestRateLimitedRelogin(t *testing.T) {
+	s := &authServer{responses: []int{451}, loginOK: true}
+	c, rt, u := newAuthClient(t, s)
+	res, err := c.Get(u, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if got := s.paths(); got != "/serv/v1/lesson /account/ticket/login /serv/v1/time /serv/v1/user/auth /serv/v1/lesson" {
+		t.Errorf("requests = %s", got)
+	}
+	if rt.throttled != 1 || rt.stw != 1 || rt.restart != 1 {
+		t.Errorf("throttled = %d, stw = %d, restart = %d", rt.throttled, rt.stw, rt.restart)
+	}
+}
+
+// 限流后重新登录失败不能当成登录过期, 否则 replay 会在限流期间再登录一次
+func TestRateLimitedReloginFailed(t *testing.T) {
+	s := &authServer{responses: []int{452}}
+	c, rt, u := newAuthClient(t, s)
+	_, err := c.Get(u, false)
+	if !errors.Is(err, ErrRateLimited) || errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("err = %v, want ErrRateLimited", err)
+	}
+	if retry.Retryable(err) {
+		t.Error("failed re-login should not be retried")
+	}
+	if got := s.paths(); got != "/serv/v1/lesson /account/ticket/login" {
+		t.Errorf("requests = %s, want a single login attempt", got)
+	}
+	if rt.stw != rt.restart {
+		t.Errorf("stw = %d, restart = %d, requests left paused", rt.stw, rt.restart)
+	}
+}
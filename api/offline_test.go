@@ -0,0 +1,33 @@
+package api
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/duc-cnzj/geekbang2md/cache"
+	"github.com/duc-cnzj/geekbang2md/transport"
+)
+
+func TestOfflineCorruptCache(t *testing.T) {
+	cache.SetQuarantine(false)
+	defer cache.SetQuarantine(true)
+
+	store := cache.NewMemoryStore()
+	raw := []byte("GBC1\x09broken entry")
+	store.Put("article-1", raw, cache.Meta{Key: "article-1", Kind: cache.KindArticle})
+	c := NewClient(WithOffline(), WithCache(&cache.Cache{Store: store})).(*client)
+
+	_, err := c.Article("1")
+	if !errors.Is(err, cache.ErrCorrupt) || errors.Is(err, ErrOffline) {
+		t.Fatalf("err = %v, want ErrCorrupt instead of a cache miss", err)
+	}
+	// 离线时缓存是唯一的副本, 不能被隔离删除
+	if got, err := store.Get("article-1"); err != nil || string(got) != string(raw) {
+		t.Errorf("corrupt entry removed: %q, %v", got, err)
+	}
+
+	_, err = c.Article("2")
+	if !errors.Is(err, ErrOffline) || !errors.Is(err, transport.ErrOffline) {
+		t.Errorf("missing entry: err = %v, want ErrOffline", err)
+	}
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// SendSMSCode 给手机号发送登录验证码, 接口要求图形验证码时返回 ErrCaptchaRequired
+func (c *client) SendSMSCode(cellphone string) error {
+	res, err := c.Post(c.accountURL+"/account/sms/code", map[string]interface{}{
+		"country":   86,
+		"cellphone": cellphone,
+		"captcha":   "",
+		"appid":     1,
+		"platform":  3,
+	}, true)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if _, err := parseSMSResponse(res); err != nil {
+		return fmt.Errorf("发送验证码失败: %w", err)
+	}
+	return nil
+}
+
+type smsResponse struct {
+	Code int `json:"code"`
+	GKError
+	Data struct {
+		Ticket string `json:"ticket"`
+	} `json:"data"`
+}
+
+// parseSMSResponse 短信接口成功时 code 为 0, 否则带上服务端的 code 和 msg 返回 *ServerError
+func parseSMSResponse(res *http.Response) (*smsResponse, error) {
+	all, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	var result smsResponse
+	if err := json.Unmarshal(all, &result); err != nil {
+		return nil, fmt.Errorf("无法解析响应 (status: %d): %w, body: %.200s", res.StatusCode, err, all)
+	}
+	if result.Code != 0 {
+		return nil, newServerError(res.StatusCode, result.Error.Code, result.Error.Msg, requestID(res, &result.GKError))
+	}
+	return &result, nil
+}
+
+// LoginBySMS 用短信验证码换取 ticket, 再通过 Token 接口拿到登录 cookie
+func (c *client) LoginBySMS(cellphone, code string) (*AuthInfo, error) {
+	res, err := c.Post(c.accountURL+"/account/sms/login", map[string]interface{}{
+		"country":   86,
+		"cellphone": cellphone,
+		"code":      code,
+		"remember":  1,
+		"platform":  3,
+		"appid":     1,
+	}, true)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	result, err := parseSMSResponse(res)
+	if err != nil {
+		return nil, fmt.Errorf("验证码登录失败: %w", err)
+	}
+	if result.Data.Ticket == "" {
+		return nil, fmt.Errorf("验证码登录失败: %w", newServerError(res.StatusCode, result.Code, "响应中没有 ticket", requestID(res, &result.GKError)).withKind(ErrUnauthorized))
+	}
+	if err := c.Token(result.Data.Ticket); err != nil {
+		return nil, err
+	}
+	ti, err := c.Time()
+	if err != nil {
+		return nil, err
+	}
+	user, err := c.UserAuth(ti.Data * 1000)
+	if err != nil {
+		return nil, err
+	}
+	c.logger.Println("登录成功")
+	return user, nil
+}
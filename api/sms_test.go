@@ -0,0 +1,78 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newSMSServer 模拟账号接口, login 为 /account/sms/login 的响应
+func newSMSServer(t *testing.T, login string) (*client, *[]string) {
+	var paths []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		switch r.URL.Path {
+		case "/account/sms/code":
+			fmt.Fprint(w, `{"code":-1,"data":[],"error":{"code":-3031,"msg":"请输入图形验证码"},"extra":{"request-id":"req-1"}}`)
+		case "/account/sms/login":
+			fmt.Fprint(w, login)
+		case "/account/ticket/token":
+			http.SetCookie(w, &http.Cookie{Name: "GCESS", Value: "token", Path: "/"})
+			fmt.Fprint(w, `{"code":0,"data":[]}`)
+		case "/serv/v1/time":
+			fmt.Fprint(w, `{"code":0,"data":1650000000}`)
+		case "/serv/v1/user/auth":
+			if c, _ := r.Cookie("GCESS"); c == nil {
+				fmt.Fprint(w, `{"code":-1,"error":{"code":-2000,"msg":"用户未登录"}}`)
+				return
+			}
+			fmt.Fprint(w, `{"code":0,"data":{"uid":1,"nick":"geek"}}`)
+		}
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return NewClient(WithBaseURL(srv.URL), WithAccountURL(srv.URL)).(*client), &paths
+}
+
+func TestSendSMSCodeCaptcha(t *testing.T) {
+	c, _ := newSMSServer(t, "")
+	err := c.SendSMSCode("13800000000")
+	if !errors.Is(err, ErrCaptchaRequired) || !strings.Contains(err.Error(), "req-1") {
+		t.Fatalf("err = %v, want ErrCaptchaRequired with request id", err)
+	}
+}
+
+func TestLoginBySMS(t *testing.T) {
+	c, paths := newSMSServer(t, `{"code":0,"data":{"ticket":"t-1"}}`)
+	user, err := c.LoginBySMS("13800000000", "123456")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Data.Nick != "geek" {
+		t.Errorf("user = %+v", user.Data)
+	}
+	if got := strings.Join(*paths, " "); got != "/account/sms/login /account/ticket/token /serv/v1/time /serv/v1/user/auth" {
+		t.Errorf("requests = %s", got)
+	}
+}
+
+func TestLoginBySMSFailed(t *testing.T) {
+	for _, body := range []string{
+		`{"code":-1,"data":[],"error":{"code":-3002,"msg":"短信验证码错误"}}`,
+		`{"code":0,"data":{"ticket":""}}`,
+		`<html>502 Bad Gateway</html>`,
+	} {
+		c, paths := newSMSServer(t, body)
+		if _, err := c.LoginBySMS("13800000000", "000000"); err == nil {
+			t.Errorf("%s: want error", body)
+		}
+		// 没有拿到 ticket 时不能再去检查登录状态, 否则已有的 cookie 会被当成登录成功
+		if len(*paths) != 1 {
+			t.Errorf("%s: requests = %v", body, *paths)
+		}
+	}
+}
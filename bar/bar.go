@@ -4,6 +4,8 @@ import (
 	"fmt"
 
 	"github.com/schollz/progressbar/v3"
+
+	"github.com/duc-cnzj/geekbang2md/utils"
 )
 
 type Interface interface {
@@ -13,6 +15,7 @@ type Interface interface {
 type Bar struct {
 	title string
 	total int
+	desc  string
 	b     *progressbar.ProgressBar
 }
 
@@ -22,10 +25,11 @@ func NewBar(title string, total int) *Bar {
 	if len(runes) > 20 {
 		runes = append(runes[0:17], []rune("...")...)
 	}
-	b := &Bar{title: title, total: total, b: progressbar.NewOptions(total,
+	desc := fmt.Sprintf("[Download]: %-20s", string(runes))
+	b := &Bar{title: title, total: total, desc: desc, b: progressbar.NewOptions(total,
 		progressbar.OptionEnableColorCodes(true),
 		progressbar.OptionSetWidth(20),
-		progressbar.OptionSetDescription(fmt.Sprintf("[Download]: %-20s", string(runes))),
+		progressbar.OptionSetDescription(desc),
 		progressbar.OptionSetTheme(progressbar.Theme{
 			Saucer:        "#",
 			SaucerHead:    "#",
@@ -38,6 +42,10 @@ func NewBar(title string, total int) *Bar {
 	return b
 }
 
+// Add 同时刷新当前的下载速度
 func (b *Bar) Add() {
+	if speed := Throughput(); speed > 0 {
+		b.b.Describe(fmt.Sprintf("%s %10s/s", b.desc, utils.Bytes(uint64(speed))))
+	}
 	b.b.Add(1)
 }
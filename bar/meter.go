@@ -0,0 +1,35 @@
+package bar
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// meter 统计所有下载的总吞吐量, 每秒最多采样一次
+var meter = &struct {
+	total int64
+
+	mu        sync.Mutex
+	lastTotal int64
+	last      time.Time
+	rate      float64
+}{last: time.Now()}
+
+// Record 下载器每读取 n 个字节调用一次
+func Record(n int) {
+	atomic.AddInt64(&meter.total, int64(n))
+}
+
+// Throughput 当前所有下载的速度, 字节/秒
+func Throughput() float64 {
+	meter.mu.Lock()
+	defer meter.mu.Unlock()
+	now := time.Now()
+	if elapsed := now.Sub(meter.last); elapsed >= time.Second {
+		total := atomic.LoadInt64(&meter.total)
+		meter.rate = float64(total-meter.lastTotal) / elapsed.Seconds()
+		meter.lastTotal, meter.last = total, now
+	}
+	return meter.rate
+}
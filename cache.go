@@ -0,0 +1,204 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/duc-cnzj/geekbang2md/cache"
+	"github.com/duc-cnzj/geekbang2md/utils"
+)
+
+var (
+	cacheAction string
+	olderThan   time.Duration
+	cacheKind   string
+	cacheCourse int
+	migrateTo   string
+	repair      bool
+)
+
+// cacheFlagSet 除了全局参数之外, 还有 cache 子命令自己的参数
+func cacheFlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("cache", flag.ExitOnError)
+	flag.CommandLine.VisitAll(func(f *flag.Flag) {
+		fs.Var(f.Value, f.Name, f.Usage)
+	})
+	fs.DurationVar(&olderThan, "older-than", 0, "prune: 删除多久之前获取的缓存, 例如 720h, 默认删除已过期的缓存")
+	fs.StringVar(&cacheKind, "kind", "", fmt.Sprintf("ls/clear: 缓存类型, 可选: %s, %s, %s, %s, %s, %s",
+		cache.KindProducts, cache.KindSkus, cache.KindInfos, cache.KindArticles, cache.KindArticle, cache.KindVideoKey))
+	fs.IntVar(&cacheCourse, "course", 0, "rm: 课程 id")
+	fs.StringVar(&migrateTo, "to", "", "migrate: 目标缓存类型, 例如 bolt, 数据从 -cache-backend 指定的缓存复制过去")
+	fs.BoolVar(&repair, "repair", false, "verify: 隔离损坏的缓存(下次运行重新获取), 并把旧格式的缓存重新压缩保存")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s cache [ls|stats|prune|clear|rm|migrate|verify] [flags]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+func cacheCommand() {
+	c := &cache.Cache{}
+	var (
+		removed []cache.Meta
+		err     error
+	)
+	switch cacheAction {
+	case "ls", "":
+		cacheList(c)
+		return
+	case "stats":
+		cacheStats(c)
+		return
+	case "prune":
+		removed, err = c.Prune(olderThan)
+	case "clear":
+		removed, err = c.Clear(cacheKind)
+	case "rm":
+		if cacheCourse == 0 {
+			log.Fatalln("请使用 --course 指定课程 id")
+		}
+		removed, err = c.RemoveCourse(cacheCourse)
+	case "migrate":
+		cacheMigrate()
+		return
+	case "verify":
+		cacheVerify(c)
+		return
+	default:
+		log.Fatalf("未知的 cache 命令 '%s', 可选: ls, stats, prune, clear, rm, migrate, verify\n", cacheAction)
+	}
+	var size int64
+	for _, m := range removed {
+		size += m.Size
+	}
+	log.Printf("删除了 %d 个缓存, 共 %s\n", len(removed), utils.Bytes(uint64(size)))
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
+
+func cacheMigrate() {
+	if migrateTo == "" || migrateTo == cacheBackend {
+		log.Fatalln("请使用 --to 指定和 -cache-backend 不同的缓存类型")
+	}
+	dst, err := cache.Open(migrateTo)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer dst.Close()
+	n, err := cache.Migrate(cache.DefaultStore(), dst)
+	log.Printf("从 %s 迁移了 %d 个缓存到 %s\n", cacheBackend, n, migrateTo)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	log.Printf("之后请使用 -cache-backend %s, 确认没问题后可以用 `-cache-backend %s cache clear` 删除旧的缓存\n", migrateTo, cacheBackend)
+}
+
+func cacheVerify(c *cache.Cache) {
+	results, err := c.Verify(repair)
+	var corrupt, legacy int
+	for _, r := range results {
+		switch {
+		case r.Err != nil:
+			corrupt++
+			fmt.Printf("%-28s %-9s %s %v\n", r.Meta.Key, r.Meta.Kind, r.Meta.URL, r.Err)
+		case r.Legacy:
+			legacy++
+		}
+	}
+	log.Printf("检查了 %d 个缓存, %d 个已损坏, %d 个是旧格式\n", len(results), corrupt, legacy)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	switch {
+	case repair:
+		log.Printf("损坏的缓存已移到 %s, 旧格式的缓存已重新压缩保存\n", filepath.Join(cache.Dir(), "quarantine"))
+	case corrupt > 0 || legacy > 0:
+		log.Println("可以使用 `cache verify --repair` 修复")
+	}
+}
+
+func cacheEntries(c *cache.Cache) []cache.Meta {
+	entries, err := c.Entries()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].FetchedAt.Before(entries[j].FetchedAt)
+	})
+	return entries
+}
+
+func cacheList(c *cache.Cache) {
+	now := time.Now()
+	for _, m := range cacheEntries(c) {
+		if cacheKind != "" && m.Kind != cacheKind {
+			continue
+		}
+		var expired string
+		if m.Expired(now) {
+			expired = "(已过期)"
+		}
+		fmt.Printf("%-28s %-9s %10s  %s %s %s\n", m.Key, m.Kind, utils.Bytes(uint64(m.Size)), fetchedAt(m.FetchedAt), m.URL, expired)
+	}
+}
+
+func cacheStats(c *cache.Cache) {
+	type stat struct {
+		count, expired int
+		size           int64
+		oldest         time.Time
+	}
+	var (
+		now   = time.Now()
+		stats = map[string]*stat{}
+		kinds []string
+		total stat
+	)
+	for _, m := range cacheEntries(c) {
+		s, ok := stats[m.Kind]
+		if !ok {
+			s = &stat{}
+			stats[m.Kind] = s
+			kinds = append(kinds, m.Kind)
+		}
+		// entries 按获取时间排序, 时间未知的旧缓存排在最前面
+		if s.oldest.IsZero() {
+			s.oldest = m.FetchedAt
+		}
+		for _, s := range []*stat{s, &total} {
+			s.count++
+			s.size += m.Size
+			if m.Expired(now) {
+				s.expired++
+			}
+		}
+	}
+	sort.Strings(kinds)
+	log.Printf("缓存目录: %s\n", cache.Dir())
+	for _, kind := range kinds {
+		s := stats[kind]
+		ttl := "永久"
+		switch d := cache.TTLs[kind]; {
+		case d == cache.SessionTTL:
+			ttl = "本次运行"
+		case d > 0:
+			ttl = d.String()
+		}
+		log.Printf("%-9s 数量: %-6d 过期: %-6d 大小: %-10s 有效期: %-10s 最早: %s\n", kind, s.count, s.expired, utils.Bytes(uint64(s.size)), ttl, fetchedAt(s.oldest))
+	}
+	log.Printf("共计 %d 个缓存, %d 个已过期, 大小 %s\n", total.count, total.expired, utils.Bytes(uint64(total.size)))
+}
+
+// fetchedAt 旧版本的缓存没有记录获取时间
+func fetchedAt(t time.Time) string {
+	if t.IsZero() {
+		return "未知"
+	}
+	return t.Format("2006-01-02 15:04")
+}
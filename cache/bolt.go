@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	dataBucket = []byte("data")
+	metaBucket = []byte("meta")
+)
+
+// BoltStore 所有缓存保存在一个 bbolt 文件中, 大量课程时不会产生几万个小文件
+type BoltStore struct {
+	db *bolt.DB
+}
+
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("打开缓存 '%s' 失败, 可能有其他进程正在使用: %w", path, err)
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(dataBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(metaBucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltStore{db: db}, nil
+}
+
+func (s *BoltStore) Get(key string) ([]byte, error) {
+	var data []byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(dataBucket).Get([]byte(key))
+		if v == nil {
+			return fmt.Errorf("%w: %s", fs.ErrNotExist, key)
+		}
+		// bbolt 返回的切片只在事务内有效
+		data = append([]byte(nil), v...)
+		return nil
+	})
+	return data, err
+}
+
+func (s *BoltStore) Meta(key string) (Meta, error) {
+	var meta Meta
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(metaBucket).Get([]byte(key))
+		if v == nil {
+			return fmt.Errorf("%w: %s", fs.ErrNotExist, key)
+		}
+		return json.Unmarshal(v, &meta)
+	})
+	return meta, err
+}
+
+func (s *BoltStore) Put(key string, data []byte, meta Meta) error {
+	marshal, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(dataBucket).Put([]byte(key), data); err != nil {
+			return err
+		}
+		return tx.Bucket(metaBucket).Put([]byte(key), marshal)
+	})
+}
+
+func (s *BoltStore) Delete(key string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(dataBucket).Delete([]byte(key)); err != nil {
+			return err
+		}
+		return tx.Bucket(metaBucket).Delete([]byte(key))
+	})
+}
+
+func (s *BoltStore) List() ([]Meta, error) {
+	var entries []Meta
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(metaBucket).ForEach(func(k, v []byte) error {
+			var meta Meta
+			if err := json.Unmarshal(v, &meta); err != nil {
+				return err
+			}
+			entries = append(entries, meta)
+			return nil
+		})
+	})
+	return entries, err
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
@@ -2,60 +2,145 @@ package cache
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
+	"strconv"
+	"time"
 )
 
-type Cache struct{}
+// ErrExpired 缓存超过了该类型的 TTL, 需要重新获取
+var ErrExpired = errors.New("cache: 缓存已过期")
 
-var dir string
+// Cache Store 为空时使用 Init/SetDefault 设置的默认存储
+type Cache struct {
+	Store Store
+}
+
+var (
+	dir          string
+	defaultStore Store = NewMemoryStore()
+	// quarantineOnGet 离线模式下缓存是唯一的数据来源, 损坏时只报告, 不隔离
+	quarantineOnGet = true
+)
 
-func Init(baseDir string) {
-	dir = filepath.Join(baseDir, ".cache")
+// session 每次运行不同, TTL 为 SessionTTL 的缓存只在本次运行内有效
+var session = strconv.FormatInt(time.Now().UnixNano(), 36)
+
+// Init namespace 不为空时缓存放在 `.cache/<namespace>` 下, 多个账号之间互不影响,
+// 默认使用文件存储, 可以用 SetDefault 替换
+func Init(baseDir string, namespace string) {
+	dir = filepath.Join(baseDir, ".cache", namespace)
 	os.MkdirAll(dir, 0755)
+	defaultStore = NewFileStore(dir)
 }
 
 func Dir() string {
 	return dir
 }
 
+func SetDefault(s Store) {
+	defaultStore = s
+}
+
+// SetQuarantine on 为 false 时 Get 遇到损坏的缓存不会隔离, 只返回 ErrCorrupt,
+// cache verify --repair 不受影响
+func SetQuarantine(on bool) {
+	quarantineOnGet = on
+}
+
+func DefaultStore() Store {
+	return defaultStore
+}
+
+func (c *Cache) store() Store {
+	if c.Store != nil {
+		return c.Store
+	}
+	return defaultStore
+}
+
 func (c *Cache) Delete(key string) error {
-	return os.Remove(c.cachePath(key))
+	return c.store().Delete(key)
 }
 
+// Get 损坏的缓存会被移到 quarantine 目录(见 SetQuarantine)并返回 ErrCorrupt,
+// 过期时返回 ErrExpired 的同时也会返回数据, 离线模式下仍然可以使用
 func (c *Cache) Get(key string) ([]byte, error) {
-	file, err := os.ReadFile(c.cachePath(key))
+	raw, err := c.store().Get(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := c.decode(key, raw)
+	if err != nil {
+		if !quarantineOnGet {
+			return nil, fmt.Errorf("'%s' %w", key, err)
+		}
+		c.quarantine(key, raw, err)
+		return nil, err
+	}
+	if c.Meta(key).Expired(time.Now()) {
+		return data, ErrExpired
+	}
+	return data, nil
+}
+
+// decode 旧格式的缓存没有 checksum, 至少检查一下 json 是否完整
+func (c *Cache) decode(key string, raw []byte) ([]byte, error) {
+	data, legacy, err := decode(raw)
 	if err != nil {
 		return nil, err
 	}
-	return file, nil
+	if legacy && KindOf(key) != KindVideoKey && !json.Valid(data) {
+		return nil, fmt.Errorf("%w: json 不完整", ErrCorrupt)
+	}
+	return data, nil
 }
 
-func (c *Cache) Set(key string, data interface{}) error {
+// quarantine 保留损坏的数据方便排查, 然后从存储中删除
+func (c *Cache) quarantine(key string, raw []byte, reason error) {
+	log.Printf("[CACHE]: '%s' %v, 已隔离, 下次重新获取\n", key, reason)
+	if dir != "" {
+		qdir := filepath.Join(dir, "quarantine")
+		os.MkdirAll(qdir, 0755)
+		os.WriteFile(filepath.Join(qdir, fmt.Sprintf("%s-%d", key, time.Now().Unix())), raw, 0644)
+	}
+	c.store().Delete(key)
+}
+
+func (c *Cache) Set(key string, data interface{}, meta Meta) error {
 	marshal, err := json.Marshal(&data)
 	if err != nil {
 		return err
 	}
-	if len(marshal) > 0 {
-		if err := os.WriteFile(c.cachePath(key), marshal, 0644); err != nil {
-			return err
-		}
-	}
-
-	return nil
+	return c.SetOrigin(key, marshal, meta)
 }
 
-func (c *Cache) SetOrigin(key string, data []byte) error {
-	if len(data) > 0 {
-		if err := os.WriteFile(c.cachePath(key), data, 0644); err != nil {
-			return err
-		}
+// SetOrigin meta 只需要填写 URL 和 Course, 其他字段自动生成
+func (c *Cache) SetOrigin(key string, data []byte, meta Meta) error {
+	if len(data) == 0 {
+		return nil
 	}
+	meta.Key = key
+	meta.Kind = KindOf(key)
+	meta.Size = int64(len(data))
+	meta.FetchedAt = time.Now()
+	meta.Session = session
+	return c.store().Put(key, encode(data), meta)
+}
 
-	return nil
+// Meta 缓存的元数据, 不存在时返回只有 Key 和 Kind 的元数据
+func (c *Cache) Meta(key string) Meta {
+	meta, err := c.store().Meta(key)
+	if err != nil {
+		return Meta{Key: key, Kind: KindOf(key)}
+	}
+	return meta
 }
 
-func (c *Cache) cachePath(key string) string {
-	return fmt.Sprintf(filepath.Join(dir, "cache-%v.json"), key)
+// Entries 所有缓存的元数据
+func (c *Cache) Entries() ([]Meta, error) {
+	return c.store().List()
 }
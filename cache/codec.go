@@ -0,0 +1,80 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// ErrCorrupt 缓存内容校验失败, 会被移动到 quarantine 目录, 下次重新获取
+var ErrCorrupt = errors.New("cache: 缓存已损坏")
+
+// 缓存条目格式: magic(4) + codec(1) + crc32(4) + 原始长度(8) + 数据,
+// crc32 和长度都是针对解压后的数据, 没有 magic 的是旧版本未压缩的缓存
+var entryMagic = []byte("GBC1")
+
+const (
+	codecNone byte = 0
+	codecGzip byte = 1
+
+	headerSize = 4 + 1 + 4 + 8
+	// compressThreshold 太小的数据(比如视频 key)压缩没有意义
+	compressThreshold = 512
+)
+
+func encode(data []byte) []byte {
+	codec, payload := codecNone, data
+	if len(data) >= compressThreshold {
+		bf := &bytes.Buffer{}
+		w, _ := gzip.NewWriterLevel(bf, gzip.BestCompression)
+		w.Write(data)
+		w.Close()
+		if bf.Len() < len(data) {
+			codec, payload = codecGzip, bf.Bytes()
+		}
+	}
+	header := make([]byte, headerSize)
+	copy(header, entryMagic)
+	header[4] = codec
+	binary.BigEndian.PutUint32(header[5:9], crc32.ChecksumIEEE(data))
+	binary.BigEndian.PutUint64(header[9:17], uint64(len(data)))
+	return append(header, payload...)
+}
+
+// decode legacy 为 true 时 raw 是旧格式, 原样返回, 没有经过校验
+func decode(raw []byte) (data []byte, legacy bool, err error) {
+	if !bytes.HasPrefix(raw, entryMagic) {
+		return raw, true, nil
+	}
+	if len(raw) < headerSize {
+		return nil, false, fmt.Errorf("%w: 长度 %d 小于文件头", ErrCorrupt, len(raw))
+	}
+	sum := binary.BigEndian.Uint32(raw[5:9])
+	size := binary.BigEndian.Uint64(raw[9:17])
+	payload := raw[headerSize:]
+	switch raw[4] {
+	case codecNone:
+		data = payload
+	case codecGzip:
+		r, err := gzip.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return nil, false, fmt.Errorf("%w: %v", ErrCorrupt, err)
+		}
+		if data, err = io.ReadAll(r); err != nil {
+			return nil, false, fmt.Errorf("%w: %v", ErrCorrupt, err)
+		}
+	default:
+		return nil, false, fmt.Errorf("%w: 未知的压缩方式 %d", ErrCorrupt, raw[4])
+	}
+	if uint64(len(data)) != size {
+		return nil, false, fmt.Errorf("%w: 长度 %d, 应该为 %d", ErrCorrupt, len(data), size)
+	}
+	if crc32.ChecksumIEEE(data) != sum {
+		return nil, false, fmt.Errorf("%w: checksum 不匹配", ErrCorrupt)
+	}
+	return data, false, nil
+}
@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func FuzzDecode(f *testing.F) {
+	f.Add([]byte(""))
+	f.Add([]byte("key"))
+	f.Add([]byte(`{"code":0,"data":{"list":[]}}`))
+	f.Add([]byte(strings.Repeat(`{"article_content":"<p>geekbang</p>"}`, 100)))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		raw := encode(data)
+		got, legacy, err := decode(raw)
+		if err != nil || legacy || !bytes.Equal(got, data) {
+			t.Fatalf("round trip: legacy=%v err=%v", legacy, err)
+		}
+		if len(data) >= compressThreshold && len(raw) >= headerSize+len(data) && raw[4] == codecGzip {
+			t.Errorf("gzip payload of %d bytes is not smaller than the data", len(raw)-headerSize)
+		}
+		// 截断或者改动任何一个字节都不能被当成正常的数据返回
+		for _, i := range []int{4, 5, 12, len(raw) - 1} {
+			if i >= len(raw) || (i == len(raw)-1 && len(data) == 0) {
+				continue
+			}
+			broken := append([]byte(nil), raw...)
+			broken[i] ^= 0x55
+			if _, _, err := decode(broken); !errors.Is(err, ErrCorrupt) {
+				t.Errorf("flip byte %d: err = %v", i, err)
+			}
+		}
+		if _, _, err := decode(raw[:headerSize-1]); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("short header: err = %v", err)
+		}
+	})
+}
+
+func TestVerifyRepair(t *testing.T) {
+	Init(t.TempDir(), "")
+	c := &Cache{Store: NewMemoryStore()}
+	article := []byte(`{"data":{"cid":100,"article_content":"` + strings.Repeat("<p>x</p>", 200) + `"}}`)
+	c.SetOrigin("article-1", article, Meta{})
+	c.Store.Put("article-2", article, Meta{Key: "article-2", Kind: KindArticle, FetchedAt: time.Now()})
+	c.Store.Put("article-3", article[:100], Meta{Key: "article-3", Kind: KindArticle})
+	c.Store.Put("keyurl-4", []byte{0x01, 0x02}, Meta{Key: "keyurl-4", Kind: KindVideoKey})
+
+	results, err := c.Verify(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]VerifyResult{}
+	for _, r := range results {
+		got[r.Meta.Key] = r
+	}
+	if r := got["article-1"]; r.Err != nil || r.Legacy {
+		t.Errorf("article-1 = %+v", r)
+	}
+	if r := got["article-2"]; r.Err != nil || !r.Legacy {
+		t.Errorf("article-2 = %+v, want legacy", r)
+	}
+	if r := got["article-3"]; !errors.Is(r.Err, ErrCorrupt) {
+		t.Errorf("article-3 = %+v, truncated legacy json should be corrupt", r)
+	}
+	// 视频 key 是二进制的, 旧格式也不检查 json
+	if r := got["keyurl-4"]; r.Err != nil {
+		t.Errorf("keyurl-4 = %+v", r)
+	}
+
+	raw, _ := c.Store.Get("article-2")
+	if !bytes.HasPrefix(raw, entryMagic) || len(raw) >= len(article) {
+		t.Error("legacy entry should be re-encoded and compressed")
+	}
+	if data, err := c.Get("article-2"); err != nil || !bytes.Equal(data, article) {
+		t.Errorf("Get after repair: %v", err)
+	}
+	if _, err := c.Store.Get("article-3"); err == nil {
+		t.Error("corrupt entry should be quarantined")
+	}
+}
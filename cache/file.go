@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// FileStore 每个 key 一个 `cache-<key>.json` 文件, 元数据保存在同名的 `.meta` 文件中
+type FileStore struct {
+	dir string
+}
+
+func NewFileStore(dir string) *FileStore {
+	os.MkdirAll(dir, 0755)
+	return &FileStore{dir: dir}
+}
+
+func (s *FileStore) Get(key string) ([]byte, error) {
+	return os.ReadFile(s.cachePath(key))
+}
+
+// Meta 没有元数据的旧缓存第一次读取时补上 `.meta` 文件, 获取时间未知, 不会过期
+func (s *FileStore) Meta(key string) (Meta, error) {
+	var meta Meta
+	if data, err := os.ReadFile(s.metaPath(key)); err == nil && json.Unmarshal(data, &meta) == nil {
+		return meta, nil
+	}
+	data, err := os.ReadFile(s.cachePath(key))
+	if err != nil {
+		return Meta{}, err
+	}
+	meta = Meta{Key: key, Kind: KindOf(key), Size: int64(len(data))}
+	switch meta.Kind {
+	case KindArticles:
+		meta.Course, _ = strconv.Atoi(strings.TrimPrefix(key, KindArticles+"-"))
+	case KindArticle:
+		var article struct {
+			Data struct {
+				Cid int `json:"cid"`
+			} `json:"data"`
+		}
+		if decoded, _, err := decode(data); err == nil && json.Unmarshal(decoded, &article) == nil {
+			meta.Course = article.Data.Cid
+		}
+	}
+	marshal, _ := json.Marshal(meta)
+	os.WriteFile(s.metaPath(key), marshal, 0644)
+	return meta, nil
+}
+
+func (s *FileStore) Put(key string, data []byte, meta Meta) error {
+	if err := os.WriteFile(s.cachePath(key), data, 0644); err != nil {
+		return err
+	}
+	marshal, _ := json.Marshal(meta)
+	return os.WriteFile(s.metaPath(key), marshal, 0644)
+}
+
+func (s *FileStore) Delete(key string) error {
+	os.Remove(s.metaPath(key))
+	return os.Remove(s.cachePath(key))
+}
+
+func (s *FileStore) List() ([]Meta, error) {
+	matches, err := filepath.Glob(filepath.Join(s.dir, "cache-*.json"))
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]Meta, 0, len(matches))
+	for _, m := range matches {
+		key := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(m), "cache-"), ".json")
+		if meta, err := s.Meta(key); err == nil {
+			entries = append(entries, meta)
+		}
+	}
+	return entries, nil
+}
+
+func (s *FileStore) Close() error {
+	return nil
+}
+
+func (s *FileStore) cachePath(key string) string {
+	return fmt.Sprintf(filepath.Join(s.dir, "cache-%v.json"), key)
+}
+
+func (s *FileStore) metaPath(key string) string {
+	return fmt.Sprintf(filepath.Join(s.dir, "cache-%v.meta"), key)
+}
@@ -0,0 +1,47 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// 升级前的缓存只有 `cache-<key>.json`, 没有 `.meta` 文件
+func TestFileStoreLegacyEntry(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "cache-article-1.json")
+	os.WriteFile(p, []byte(`{"code":0,"data":{"cid":42,"article_title":"开篇词"}}`), 0644)
+	old := time.Now().Add(-200 * 24 * time.Hour)
+	os.Chtimes(p, old, old)
+
+	c := &Cache{Store: NewFileStore(dir)}
+	if _, err := c.Get("article-1"); err != nil {
+		t.Fatalf("legacy entry with unknown age should not expire: %v", err)
+	}
+	m := c.Meta("article-1")
+	if m.Course != 42 || !m.FetchedAt.IsZero() || m.Kind != KindArticle {
+		t.Errorf("meta = %+v", m)
+	}
+
+	var sidecar Meta
+	data, err := os.ReadFile(filepath.Join(dir, "cache-article-1.meta"))
+	if err != nil || json.Unmarshal(data, &sidecar) != nil || sidecar.Course != 42 {
+		t.Fatalf("sidecar meta not written: %s, %v", data, err)
+	}
+	// 补上 .meta 之后不再需要读取缓存内容
+	os.WriteFile(p, []byte(`{"data":{"cid":7}}`), 0644)
+	if m := c.Meta("article-1"); m.Course != 42 {
+		t.Errorf("Course = %d, want the sidecar value", m.Course)
+	}
+
+	// 时间未知的缓存不会被按时间清理
+	if removed, _ := c.Prune(time.Hour); len(removed) != 0 {
+		t.Errorf("Prune removed %v", removed)
+	}
+	if _, err := c.Store.Meta("article-404"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing entry: err = %v", err)
+	}
+}
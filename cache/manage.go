@@ -0,0 +1,73 @@
+package cache
+
+import (
+	"strings"
+	"time"
+)
+
+// Prune 删除 olderThan 之前获取的缓存, olderThan 为 0 时删除所有已过期的缓存,
+// 获取时间未知的旧缓存不会按时间删除
+func (c *Cache) Prune(olderThan time.Duration) ([]Meta, error) {
+	now := time.Now()
+	return c.remove(func(m Meta) bool {
+		if olderThan > 0 {
+			if m.FetchedAt.IsZero() {
+				return false
+			}
+			return now.Sub(m.FetchedAt) > olderThan
+		}
+		return m.Expired(now)
+	})
+}
+
+// Clear 删除某一类缓存, kind 为空时删除全部
+func (c *Cache) Clear(kind string) ([]Meta, error) {
+	return c.remove(func(m Meta) bool {
+		return kind == "" || m.Kind == kind
+	})
+}
+
+// RemoveCourse 删除课程的文章列表、文章以及视频 key
+func (c *Cache) RemoveCourse(cid int) ([]Meta, error) {
+	entries, err := c.Entries()
+	if err != nil {
+		return nil, err
+	}
+	articles := map[string]bool{}
+	for _, m := range entries {
+		if m.Kind == KindArticle && m.Course == cid {
+			articles[strings.TrimPrefix(m.Key, KindArticle+"-")] = true
+		}
+	}
+	return c.remove(func(m Meta) bool {
+		if m.Kind == KindVideoKey {
+			return articles[strings.TrimPrefix(m.Key, KindVideoKey+"-")]
+		}
+		return m.Course == cid
+	})
+}
+
+// RemovePrefix 删除 key 以 prefix 开头的缓存
+func (c *Cache) RemovePrefix(prefix string) ([]Meta, error) {
+	return c.remove(func(m Meta) bool {
+		return strings.HasPrefix(m.Key, prefix)
+	})
+}
+
+func (c *Cache) remove(match func(Meta) bool) ([]Meta, error) {
+	entries, err := c.Entries()
+	if err != nil {
+		return nil, err
+	}
+	var removed []Meta
+	for _, m := range entries {
+		if !match(m) {
+			continue
+		}
+		if err := c.Delete(m.Key); err != nil {
+			return removed, err
+		}
+		removed = append(removed, m)
+	}
+	return removed, nil
+}
@@ -0,0 +1,51 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// 旧版本把短信登录的 cookie 明文保存在 `cache-sms-cookies-<phone>.json`
+func TestRemovePrefixLegacySMSCookies(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"cache-sms-cookies-13800000000.json", "cache-sms-cookies-13900000000.json", "cache-article-1.json"} {
+		os.WriteFile(filepath.Join(dir, name), []byte(`{"code":0,"data":{}}`), 0644)
+	}
+	c := &Cache{Store: NewFileStore(dir)}
+	if err := c.Store.Put("products", []byte(`{"code":0}`), Meta{Key: "products", Kind: KindProducts}); err != nil {
+		t.Fatal(err)
+	}
+	// 读一次 meta, 让其中一个旧缓存补上 .meta 文件
+	c.Meta("sms-cookies-13800000000")
+	if _, err := os.Stat(filepath.Join(dir, "cache-sms-cookies-13800000000.meta")); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := c.RemovePrefix("sms-cookies-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, m := range removed {
+		keys = append(keys, m.Key)
+	}
+	sort.Strings(keys)
+	if len(keys) != 2 || keys[0] != "sms-cookies-13800000000" || keys[1] != "sms-cookies-13900000000" {
+		t.Errorf("removed = %v", keys)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	for _, f := range files {
+		if base := filepath.Base(f); strings.HasPrefix(base, "cache-sms-") {
+			t.Errorf("%s not removed", base)
+		}
+	}
+	for _, key := range []string{"article-1", "products"} {
+		if _, err := c.Get(key); err != nil {
+			t.Errorf("%s: %v", key, err)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package cache
+
+import (
+	"fmt"
+	"io/fs"
+	"sync"
+)
+
+// MemoryStore 只保存在内存中, 退出后丢失, api.NewClient 默认使用, 也用于测试
+type MemoryStore struct {
+	mu    sync.RWMutex
+	data  map[string][]byte
+	metas map[string]Meta
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{data: map[string][]byte{}, metas: map[string]Meta{}}
+}
+
+func (s *MemoryStore) Get(key string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, ok := s.data[key]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", fs.ErrNotExist, key)
+	}
+	return append([]byte(nil), data...), nil
+}
+
+func (s *MemoryStore) Meta(key string) (Meta, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	meta, ok := s.metas[key]
+	if !ok {
+		return Meta{}, fmt.Errorf("%w: %s", fs.ErrNotExist, key)
+	}
+	return meta, nil
+}
+
+func (s *MemoryStore) Put(key string, data []byte, meta Meta) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[key] = append([]byte(nil), data...)
+	s.metas[key] = meta
+	return nil
+}
+
+func (s *MemoryStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data, key)
+	delete(s.metas, key)
+	return nil
+}
+
+func (s *MemoryStore) List() ([]Meta, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entries := make([]Meta, 0, len(s.metas))
+	for _, m := range s.metas {
+		entries = append(entries, m)
+	}
+	return entries, nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
@@ -0,0 +1,81 @@
+package cache
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// 缓存的类型, 即 key 中第一个 `-` 之前的部分
+const (
+	KindProducts = "products"
+	KindSkus     = "skus"
+	KindInfos    = "infos"
+	KindArticles = "articles"
+	KindArticle  = "article"
+	KindVideoKey = "keyurl"
+)
+
+// SessionTTL 只在本次运行内有效, 例如视频的解密 key
+const SessionTTL time.Duration = -1
+
+// TTLs 每种类型缓存的有效期, 0 表示永久有效, 没有配置的类型永久有效
+var TTLs = map[string]time.Duration{
+	KindProducts: 10 * time.Minute,
+	KindSkus:     time.Hour,
+	KindInfos:    time.Hour,
+	KindArticles: 24 * time.Hour,
+	KindArticle:  90 * 24 * time.Hour,
+	KindVideoKey: SessionTTL,
+}
+
+// Meta 缓存的元数据
+type Meta struct {
+	Key       string    `json:"key"`
+	Kind      string    `json:"kind"`
+	URL       string    `json:"url,omitempty"`
+	Course    int       `json:"course,omitempty"`
+	Size      int64     `json:"size"`
+	FetchedAt time.Time `json:"fetched_at"`
+	Session   string    `json:"session,omitempty"`
+}
+
+// Expired 获取时间未知(旧版本的缓存)时只有 SessionTTL 的类型会过期
+func (m Meta) Expired(now time.Time) bool {
+	switch ttl := TTLs[m.Kind]; {
+	case ttl == SessionTTL:
+		return m.Session != session
+	case ttl > 0 && !m.FetchedAt.IsZero():
+		return now.Sub(m.FetchedAt) > ttl
+	}
+	return false
+}
+
+func KindOf(key string) string {
+	kind, _, _ := strings.Cut(key, "-")
+	return kind
+}
+
+// ParseTTLs 解析 `products=10m,article=0,keyurl=session`, 只修改指定的类型
+func ParseTTLs(spec string) error {
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kind, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return fmt.Errorf("缓存有效期 '%s' 格式不正确, 应该为 kind=duration", item)
+		}
+		if value == "session" {
+			TTLs[kind] = SessionTTL
+			continue
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("缓存有效期 '%s': %w", item, err)
+		}
+		TTLs[kind] = d
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package cache
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// Store 缓存的底层存储, key 不存在时返回的错误满足 errors.Is(err, fs.ErrNotExist)
+type Store interface {
+	Get(key string) ([]byte, error)
+	Meta(key string) (Meta, error)
+	// Put 原样保存 meta, 迁移时会保留原来的获取时间
+	Put(key string, data []byte, meta Meta) error
+	Delete(key string) error
+	List() ([]Meta, error)
+	Close() error
+}
+
+// 可选的缓存后端
+const (
+	BackendFile   = "file"
+	BackendBolt   = "bolt"
+	BackendMemory = "memory"
+)
+
+// Open 在 Dir() 下打开指定类型的存储, 需要先调用 Init
+func Open(backend string) (Store, error) {
+	switch backend {
+	case BackendFile, "":
+		return NewFileStore(dir), nil
+	case BackendBolt:
+		return NewBoltStore(filepath.Join(dir, "cache.db"))
+	case BackendMemory:
+		return NewMemoryStore(), nil
+	}
+	return nil, fmt.Errorf("未知的缓存类型 '%s', 可选: %s, %s, %s", backend, BackendFile, BackendBolt, BackendMemory)
+}
+
+// Migrate 把 src 中的缓存全部复制到 dst, 不会删除 src 中的数据
+func Migrate(src, dst Store) (int, error) {
+	entries, err := src.List()
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	for _, m := range entries {
+		data, err := src.Get(m.Key)
+		if err != nil {
+			return n, err
+		}
+		if err := dst.Put(m.Key, data, m); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
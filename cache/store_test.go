@@ -0,0 +1,149 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func openStores(t *testing.T) map[string]Store {
+	dir := t.TempDir()
+	bolt, err := NewBoltStore(filepath.Join(dir, "cache.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileDir := filepath.Join(dir, "file")
+	os.MkdirAll(fileDir, 0755)
+	stores := map[string]Store{
+		BackendFile:   NewFileStore(fileDir),
+		BackendBolt:   bolt,
+		BackendMemory: NewMemoryStore(),
+	}
+	t.Cleanup(func() {
+		for _, s := range stores {
+			s.Close()
+		}
+	})
+	return stores
+}
+
+func TestStores(t *testing.T) {
+	fetchedAt := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	entries := []struct {
+		key  string
+		data []byte
+		meta Meta
+	}{
+		{"articles-100", []byte(`{"data":{"list":[]}}`), Meta{Kind: KindArticles, URL: "https://time.geekbang.org/serv/v1/column/articles", Course: 100}},
+		{"article-1", encode([]byte(`{"data":{"cid":100}}`)), Meta{Kind: KindArticle, Course: 100}},
+		{"keyurl-1", []byte{0x00, 0x01, 0xff}, Meta{Kind: KindVideoKey, Session: "s"}},
+	}
+	for name, s := range openStores(t) {
+		t.Run(name, func(t *testing.T) {
+			if _, err := s.Get("article-404"); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("Get missing: err = %v, want fs.ErrNotExist", err)
+			}
+			if _, err := s.Meta("article-404"); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("Meta missing: err = %v, want fs.ErrNotExist", err)
+			}
+			for _, e := range entries {
+				m := e.meta
+				m.Key, m.Size, m.FetchedAt = e.key, int64(len(e.data)), fetchedAt
+				if err := s.Put(e.key, e.data, m); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, e := range entries {
+				data, err := s.Get(e.key)
+				if err != nil || !bytes.Equal(data, e.data) {
+					t.Errorf("Get(%s) = %q, %v", e.key, data, err)
+				}
+				m, err := s.Meta(e.key)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if m.Key != e.key || m.Kind != e.meta.Kind || m.Course != e.meta.Course || m.URL != e.meta.URL ||
+					m.Session != e.meta.Session || !m.FetchedAt.Equal(fetchedAt) {
+					t.Errorf("Meta(%s) = %+v", e.key, m)
+				}
+			}
+			if got := keys(t, s); len(got) != len(entries) {
+				t.Errorf("List = %v", got)
+			}
+			if err := s.Delete("article-1"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.Get("article-1"); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("Get after Delete: err = %v", err)
+			}
+			if got := keys(t, s); len(got) != len(entries)-1 {
+				t.Errorf("List after Delete = %v", got)
+			}
+		})
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	stores := openStores(t)
+	src := stores[BackendFile]
+	fetchedAt := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	for _, key := range []string{"articles-1", "article-2", "keyurl-3"} {
+		if err := src.Put(key, encode([]byte(key)), Meta{Key: key, Kind: KindOf(key), FetchedAt: fetchedAt}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{BackendBolt, BackendMemory} {
+		dst := stores[name]
+		n, err := Migrate(src, dst)
+		if err != nil || n != 3 {
+			t.Fatalf("Migrate to %s = %d, %v", name, n, err)
+		}
+		for _, key := range keys(t, src) {
+			want, _ := src.Get(key)
+			got, err := dst.Get(key)
+			if err != nil || !bytes.Equal(got, want) {
+				t.Errorf("%s: Get(%s) = %q, %v", name, key, got, err)
+			}
+			if m, _ := dst.Meta(key); !m.FetchedAt.Equal(fetchedAt) {
+				t.Errorf("%s: FetchedAt(%s) = %s, want %s", name, key, m.FetchedAt, fetchedAt)
+			}
+		}
+	}
+}
+
+func TestCacheQuarantine(t *testing.T) {
+	Init(t.TempDir(), "")
+	c := &Cache{}
+	if err := c.SetOrigin("article-1", bytes.Repeat([]byte("a"), 2048), Meta{}); err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := c.store().Get("article-1")
+	c.store().Put("article-1", raw[:len(raw)-4], c.Meta("article-1"))
+	if _, err := c.Get("article-1"); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("err = %v, want ErrCorrupt", err)
+	}
+	if _, err := c.store().Get("article-1"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("corrupt entry still in store: %v", err)
+	}
+	if q, _ := os.ReadDir(filepath.Join(Dir(), "quarantine")); len(q) != 1 {
+		t.Errorf("quarantine has %d files, want 1", len(q))
+	}
+}
+
+func keys(t *testing.T, s Store) []string {
+	entries, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, m := range entries {
+		keys = append(keys, m.Key)
+	}
+	sort.Strings(keys)
+	return keys
+}
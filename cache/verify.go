@@ -0,0 +1,43 @@
+package cache
+
+// VerifyResult Err 不为空时缓存已损坏, Legacy 为旧格式(未压缩、没有 checksum)
+type VerifyResult struct {
+	Meta   Meta
+	Err    error
+	Legacy bool
+}
+
+// Verify 校验所有缓存, repair 时隔离损坏的缓存, 并把旧格式的缓存重新压缩保存
+func (c *Cache) Verify(repair bool) ([]VerifyResult, error) {
+	entries, err := c.Entries()
+	if err != nil {
+		return nil, err
+	}
+	results := make([]VerifyResult, 0, len(entries))
+	for _, m := range entries {
+		raw, err := c.store().Get(m.Key)
+		if err != nil {
+			results = append(results, VerifyResult{Meta: m, Err: err})
+			if repair {
+				c.store().Delete(m.Key)
+			}
+			continue
+		}
+		_, legacy, _ := decode(raw)
+		data, err := c.decode(m.Key, raw)
+		results = append(results, VerifyResult{Meta: m, Err: err, Legacy: legacy && err == nil})
+		if !repair {
+			continue
+		}
+		switch {
+		case err != nil:
+			c.quarantine(m.Key, raw, err)
+		case legacy:
+			m.Size = int64(len(data))
+			if err := c.store().Put(m.Key, encode(data), m); err != nil {
+				return results, err
+			}
+		}
+	}
+	return results, nil
+}
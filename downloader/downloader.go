@@ -0,0 +1,259 @@
+package downloader
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/duc-cnzj/geekbang2md/retry"
+	"github.com/duc-cnzj/geekbang2md/transport"
+)
+
+// ErrIncomplete 下载的字节数和服务端声明的大小不一致, `.part` 文件会被保留, 重试时从断点继续
+var ErrIncomplete = fmt.Errorf("%w: download incomplete", retry.ErrRetry)
+
+// ErrStalled 连续 StallTimeout 没有收到任何数据, 已下载的部分保留在 `.part` 中, 重试时续传
+var ErrStalled = fmt.Errorf("%w: download stalled", retry.ErrRetry)
+
+// Default 默认下载器
+var Default = New(transport.NewClient())
+
+// Downloader 支持断点续传的文件下载器
+//
+// 数据先写入 `<dst>.part`, 同时在 `<dst>.part.meta` 中记录 ETag/Last-Modified/大小,
+// 中断后再次下载时使用 Range + If-Range 续传, 大小校验通过后才 rename 成 dst,
+// 所以 dst 只要存在就一定是完整的文件。
+type Downloader struct {
+	c *http.Client
+
+	// StallTimeout 下载过程中超过这个时间没有收到数据就中断, 0 表示不检测
+	StallTimeout time.Duration
+	// MaxBandwidth 单个文件的最大下载速度, 字节/秒, 0 表示不限制
+	MaxBandwidth int64
+}
+
+func New(c *http.Client) *Downloader {
+	return &Downloader{c: c, StallTimeout: 30 * time.Second}
+}
+
+// SetCookieJar 下载需要登录态的资源时使用和接口相同的 cookie
+func (d *Downloader) SetCookieJar(jar http.CookieJar) {
+	d.c.Jar = jar
+}
+
+type meta struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag"`
+	LastModified string `json:"last_modified"`
+	Size         int64  `json:"size"`
+}
+
+// validator If-Range 只接受强校验的 ETag, 弱 ETag 时退回 Last-Modified
+func (m *meta) validator() string {
+	if m.ETag != "" && !strings.HasPrefix(m.ETag, "W/") {
+		return m.ETag
+	}
+	return m.LastModified
+}
+
+// Download 下载 u 到 dst, 返回 dst 的大小
+func (d *Downloader) Download(u, dst string) (int64, error) {
+	if st, err := os.Stat(dst); err == nil && st.Mode().IsRegular() && st.Size() > 0 {
+		return st.Size(), nil
+	}
+	part := dst + ".part"
+
+	var offset int64
+	m := readMeta(part)
+	if st, err := os.Stat(part); err == nil && m != nil && m.URL == u && m.validator() != "" {
+		offset = st.Size()
+	}
+
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return 0, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", m.validator())
+	}
+	res, err := d.c.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	var (
+		total = res.ContentLength
+		flag  = os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	)
+	switch res.StatusCode {
+	case http.StatusOK:
+		offset = 0
+	case http.StatusPartialContent:
+		start, size, ok := parseContentRange(res.Header.Get("Content-Range"))
+		etag := res.Header.Get("ETag")
+		if !ok || start != offset || (m.Size > 0 && size != m.Size) || (etag != "" && m.ETag != "" && etag != m.ETag) {
+			// 服务端的文件已经变了, 丢弃旧数据从头下载
+			reset(part)
+			return d.Download(u, dst)
+		}
+		total = size
+		flag = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	case http.StatusRequestedRangeNotSatisfiable:
+		if m.Size > 0 && offset == m.Size {
+			return offset, finish(part, dst)
+		}
+		reset(part)
+		return d.Download(u, dst)
+	default:
+		return 0, &retry.StatusError{URL: u, StatusCode: res.StatusCode}
+	}
+
+	if err := writeMeta(part, &meta{
+		URL:          u,
+		ETag:         res.Header.Get("ETag"),
+		LastModified: res.Header.Get("Last-Modified"),
+		Size:         total,
+	}); err != nil {
+		return 0, err
+	}
+	f, err := os.OpenFile(part, flag, 0644)
+	if err != nil {
+		return 0, err
+	}
+	n, err := d.copy(f, res.Body)
+	if errors.Is(err, ErrStalled) {
+		err = fmt.Errorf("%w: '%s' %s 内没有收到数据", err, u, d.StallTimeout)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return offset + n, err
+	}
+	if total >= 0 && offset+n != total {
+		return offset + n, fmt.Errorf("%w: '%s' got %d bytes, want %d", ErrIncomplete, u, offset+n, total)
+	}
+	if offset+n == 0 {
+		reset(part)
+		return 0, fmt.Errorf("%w: '%s' empty body", ErrIncomplete, u)
+	}
+
+	return offset + n, finish(part, dst)
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	atomic.AddInt64(&c.n, int64(n))
+	return n, err
+}
+
+// copy 每隔 StallTimeout 检查一次进度, 没有进度时关闭 body 让 io.Copy 返回
+func (d *Downloader) copy(dst io.Writer, body io.ReadCloser) (int64, error) {
+	if d.StallTimeout <= 0 {
+		return io.Copy(dst, d.reader(body))
+	}
+	cr := &countingReader{r: body}
+	tr := d.reader(cr)
+	done := make(chan struct{})
+	var stalled int32
+	go func() {
+		ticker := time.NewTicker(d.StallTimeout)
+		defer ticker.Stop()
+		var last int64
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				n := atomic.LoadInt64(&cr.n)
+				if n == last && atomic.LoadInt32(&tr.waiting) == 0 {
+					atomic.StoreInt32(&stalled, 1)
+					body.Close()
+					return
+				}
+				last = n
+			}
+		}
+	}()
+	n, err := io.Copy(dst, tr)
+	close(done)
+	if atomic.LoadInt32(&stalled) == 1 {
+		return n, ErrStalled
+	}
+	return n, err
+}
+
+func finish(part, dst string) error {
+	if err := os.Rename(part, dst); err != nil {
+		return err
+	}
+	os.Remove(metaPath(part))
+	return nil
+}
+
+func reset(part string) {
+	os.Remove(part)
+	os.Remove(metaPath(part))
+}
+
+func metaPath(part string) string {
+	return part + ".meta"
+}
+
+func readMeta(part string) *meta {
+	file, err := os.ReadFile(metaPath(part))
+	if err != nil {
+		return nil
+	}
+	m := &meta{}
+	if err := json.Unmarshal(file, m); err != nil {
+		return nil
+	}
+	return m
+}
+
+func writeMeta(part string, m *meta) error {
+	marshal, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(metaPath(part), marshal, 0644)
+}
+
+// parseContentRange 解析 `bytes 100-199/200`
+func parseContentRange(s string) (start, size int64, ok bool) {
+	s = strings.TrimPrefix(s, "bytes ")
+	rg, sz, found := strings.Cut(s, "/")
+	if !found {
+		return 0, 0, false
+	}
+	from, _, found := strings.Cut(rg, "-")
+	if !found {
+		return 0, 0, false
+	}
+	var err error
+	if start, err = strconv.ParseInt(from, 10, 64); err != nil {
+		return 0, 0, false
+	}
+	if sz == "*" {
+		return start, -1, true
+	}
+	if size, err = strconv.ParseInt(sz, 10, 64); err != nil {
+		return 0, 0, false
+	}
+	return start, size, true
+}
@@ -0,0 +1,114 @@
+package downloader
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/duc-cnzj/geekbang2md/retry"
+)
+
+// flakyServer 第一次请求只返回前 cut 字节就断开, 之后正常按 Range 返回
+type flakyServer struct {
+	data   []byte
+	etag   string
+	cut    int
+	ranges []string
+}
+
+func (s *flakyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.ranges = append(s.ranges, r.Header.Get("Range"))
+	w.Header().Set("ETag", s.etag)
+	if len(s.ranges) == 1 && s.cut > 0 {
+		w.Header().Set("Content-Length", strconv.Itoa(len(s.data)))
+		w.Write(s.data[:s.cut])
+		return
+	}
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(s.data))
+}
+
+func TestDownloadResumeAfterDisconnect(t *testing.T) {
+	data := bytes.Repeat([]byte("geekbang"), 4096)
+	s := &flakyServer{data: data, etag: `"v1"`, cut: 10000}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	dst := filepath.Join(t.TempDir(), "01.mp3")
+	d := New(srv.Client())
+
+	if _, err := d.Download(srv.URL, dst); !retry.Retryable(err) {
+		t.Fatalf("first download: err = %v, want retryable", err)
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Fatal("dst must not exist before the download completes")
+	}
+	if st, _ := os.Stat(dst + ".part"); st == nil || st.Size() != int64(s.cut) {
+		t.Fatalf("part = %v, want %d bytes", st, s.cut)
+	}
+
+	n, err := d.Download(srv.URL, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(data)) || s.ranges[1] != "bytes=10000-" {
+		t.Errorf("n = %d, Range = %q", n, s.ranges[1])
+	}
+	if got, _ := os.ReadFile(dst); !bytes.Equal(got, data) {
+		t.Error("resumed file differs from the server")
+	}
+	for _, p := range []string{dst + ".part", metaPath(dst + ".part")} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("%s left behind", filepath.Base(p))
+		}
+	}
+
+	// 已经存在的文件直接返回, 不再请求
+	if n, err := d.Download(srv.URL, dst); err != nil || n != int64(len(data)) || len(s.ranges) != 2 {
+		t.Errorf("second Download = %d, %v, requests = %d", n, err, len(s.ranges))
+	}
+}
+
+func TestDownloadRestartWhenFileChanged(t *testing.T) {
+	s := &flakyServer{data: bytes.Repeat([]byte("v1"), 4096), etag: `"v1"`, cut: 3000}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	dst := filepath.Join(t.TempDir(), "cover.jpg")
+	d := New(srv.Client())
+	d.Download(srv.URL, dst)
+
+	// 断开后服务端换了文件, If-Range 不匹配时服务端返回 200 整个文件
+	s.data, s.etag = bytes.Repeat([]byte("v2"), 4096), `"v2"`
+	if _, err := d.Download(srv.URL, dst); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(dst); !bytes.Equal(got, s.data) {
+		t.Error("stale data from the old file was kept")
+	}
+}
+
+func TestDownloadStatusError(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	_, err := New(srv.Client()).Download(srv.URL, filepath.Join(t.TempDir(), "a"))
+	var se *retry.StatusError
+	if !errors.As(err, &se) || se.StatusCode != http.StatusNotFound || retry.Retryable(err) {
+		t.Fatalf("err = %v, want non-retryable 404", err)
+	}
+}
+
+func TestParseContentRange(t *testing.T) {
+	if start, size, ok := parseContentRange("bytes 100-199/1000"); !ok || start != 100 || size != 1000 {
+		t.Errorf("got %d %d %v", start, size, ok)
+	}
+	if _, size, ok := parseContentRange("bytes 100-199/*"); !ok || size != -1 {
+		t.Errorf("unknown size = %d %v, want -1", size, ok)
+	}
+	if _, _, ok := parseContentRange("bytes */1000"); ok {
+		t.Error("unsatisfied range should not be accepted")
+	}
+}
@@ -0,0 +1,80 @@
+package downloader
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/time/rate"
+
+	"github.com/duc-cnzj/geekbang2md/bar"
+)
+
+var (
+	bandwidthMu sync.RWMutex
+	// bandwidth 所有下载共用的带宽限制, nil 表示不限制
+	bandwidth *rate.Limiter
+)
+
+// SetMaxBandwidth 限制所有下载的总带宽, 单位字节/秒, 0 表示不限制
+func SetMaxBandwidth(bytesPerSecond int64) {
+	bandwidthMu.Lock()
+	defer bandwidthMu.Unlock()
+	bandwidth = newBandwidthLimiter(bytesPerSecond)
+}
+
+func newBandwidthLimiter(bytesPerSecond int64) *rate.Limiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	burst := bytesPerSecond
+	if burst > 1<<20 {
+		burst = 1 << 20
+	}
+	return rate.NewLimiter(rate.Limit(bytesPerSecond), int(burst))
+}
+
+// throttledReader 每次 Read 之后按读到的字节数从令牌桶中取令牌, 同时统计下载速度
+type throttledReader struct {
+	r        io.Reader
+	limiters []*rate.Limiter
+	max      int
+	// waiting 正在等待令牌, 这段时间没有数据不算卡住
+	waiting int32
+}
+
+// reader 全局限速之外, MaxBandwidth 限制单个文件的下载速度
+func (d *Downloader) reader(r io.Reader) *throttledReader {
+	tr := &throttledReader{r: r}
+	bandwidthMu.RLock()
+	if bandwidth != nil {
+		tr.limiters = append(tr.limiters, bandwidth)
+	}
+	bandwidthMu.RUnlock()
+	if l := newBandwidthLimiter(d.MaxBandwidth); l != nil {
+		tr.limiters = append(tr.limiters, l)
+	}
+	for _, l := range tr.limiters {
+		if tr.max == 0 || l.Burst() < tr.max {
+			tr.max = l.Burst()
+		}
+	}
+	return tr
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if t.max > 0 && len(p) > t.max {
+		p = p[:t.max]
+	}
+	n, err := t.r.Read(p)
+	if n > 0 {
+		bar.Record(n)
+		atomic.StoreInt32(&t.waiting, 1)
+		for _, l := range t.limiters {
+			l.WaitN(context.Background(), n)
+		}
+		atomic.StoreInt32(&t.waiting, 0)
+	}
+	return n, err
+}
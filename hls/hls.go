@@ -0,0 +1,279 @@
+package hls
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/duc-cnzj/geekbang2md/api"
+	"github.com/duc-cnzj/geekbang2md/bar"
+	"github.com/duc-cnzj/geekbang2md/downloader"
+	"github.com/duc-cnzj/geekbang2md/retry"
+	"github.com/duc-cnzj/geekbang2md/utils"
+	"github.com/duc-cnzj/geekbang2md/waiter"
+)
+
+var (
+	keyMethodRegexp = regexp.MustCompile(`METHOD=([\w-]+)`)
+	keyURIRegexp    = regexp.MustCompile(`URI="(.*?)"`)
+	keyIVRegexp     = regexp.MustCompile(`IV=0[xX]([0-9a-fA-F]+)`)
+)
+
+type Seg struct {
+	id      int
+	path    string
+	fullUrl string
+}
+
+type Segs []*Seg
+
+func (s Segs) Len() int {
+	return len(s)
+}
+
+func (s Segs) Less(i, j int) bool {
+	return s[i].id < s[j].id
+}
+
+func (s Segs) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+var ErrorRetry = retry.ErrRetry
+
+func DeleteSegs(segs ...*Seg) error {
+	for _, seg := range segs {
+		if err := os.Remove(seg.path); err != nil {
+			log.Printf("remove '%s', err: %v", seg.path, err)
+		}
+	}
+	return nil
+}
+
+// HLS 一个 m3u8 的下载任务, 视频和专栏音频共用
+type HLS struct {
+	// URL m3u8 地址
+	URL string
+	// BaseURL segment 的地址前缀, 为空时相对 m3u8 所在目录
+	BaseURL string
+	// SegDir segment 的临时下载目录
+	SegDir string
+	// Title 进度条显示的标题
+	Title string
+	// ID 文章 id, 用来缓存解密的 key
+	ID string
+}
+
+type hlsKey struct {
+	uri string
+	iv  []byte
+}
+
+// parsePlaylist 解析 m3u8 中的 segment 和 `#EXT-X-KEY`, 没有加密时 key 为 nil
+func (h *HLS) parsePlaylist(m3u8 []byte) (Segs, *hlsKey, error) {
+	base, err := url.Parse(h.URL)
+	if err != nil {
+		return nil, nil, err
+	}
+	if h.BaseURL != "" {
+		if base, err = url.Parse(h.BaseURL); err != nil {
+			return nil, nil, err
+		}
+	}
+	var (
+		items Segs
+		key   *hlsKey
+	)
+	scanner := bufio.NewScanner(bytes.NewReader(m3u8))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#EXT-X-KEY") {
+			if m := keyMethodRegexp.FindStringSubmatch(line); m != nil && m[1] == "NONE" {
+				continue
+			}
+			if m := keyURIRegexp.FindStringSubmatch(line); m != nil {
+				key = &hlsKey{uri: m[1], iv: make([]byte, 16)}
+				if iv := keyIVRegexp.FindStringSubmatch(line); iv != nil {
+					if decoded, err := hex.DecodeString(fmt.Sprintf("%032s", iv[1])); err == nil {
+						key.iv = decoded
+					}
+				}
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		ref, err := url.Parse(line)
+		if err != nil {
+			return nil, nil, err
+		}
+		items = append(items, &Seg{
+			id:      len(items),
+			path:    filepath.Join(h.SegDir, utils.FilterCharacters(path.Base(ref.Path))),
+			fullUrl: base.ResolveReference(ref).String(),
+		})
+	}
+	return items, key, scanner.Err()
+}
+
+// Download 并发下载 m3u8 的所有 segment, 需要时解密, 按顺序合并写入 downloadPath,
+// 请求和 segment 在内部已经重试过, 返回的错误就是最终结果, 调用方不要再整体重试
+func Download(downloadPath string, h *HLS) error {
+	stat, err := os.Stat(downloadPath)
+	if err == nil && stat.Size() > 0 {
+		return nil
+	}
+
+	get, err := api.NewBackoffClient(0).Get(h.URL)
+	if err != nil {
+		return err
+	}
+	defer get.Body.Close()
+	m3u8, err := io.ReadAll(get.Body)
+	if err != nil {
+		return err
+	}
+	items, k, err := h.parsePlaylist(m3u8)
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		return fmt.Errorf("m3u8 '%s' 中没有找到 segment", h.URL)
+	}
+
+	os.MkdirAll(h.SegDir, 0755)
+	var (
+		wg      = sync.WaitGroup{}
+		errOnce sync.Once
+		segErr  error
+	)
+	var b bar.Interface = bar.NewBar(h.Title, len(items))
+	for i := range items {
+		wg.Add(1)
+		limiter := waiter.Default.ForURL(items[i].fullUrl, waiter.ClassSegment)
+		limiter.Wait(context.TODO())
+		go func(s *Seg) {
+			defer wg.Done()
+			defer b.Add()
+			defer limiter.Release()
+			if err := retry.Do(s.fullUrl, func() error {
+				_, err := downloader.Default.Download(s.fullUrl, s.path)
+				return err
+			}); err != nil {
+				log.Printf("http '%s' err: '%v'\n", s.fullUrl, err)
+				// 每个 segment 已经按 retry.Default 重试过了, 这里的错误就是最终结果
+				errOnce.Do(func() {
+					segErr = fmt.Errorf("segment '%s' 下载失败: %w", s.fullUrl, err)
+				})
+			}
+		}(items[i])
+	}
+
+	wg.Wait()
+	if segErr != nil {
+		return segErr
+	}
+	sort.Sort(items)
+	var key []byte
+	if k != nil {
+		if key, err = api.VideoKey(k.uri, h.ID); err != nil {
+			return err
+		}
+		if len(key) == 0 {
+			api.DeleteArticleCache(h.ID)
+			return fmt.Errorf("%w, 当前获取不到解码的 key 值", ErrorRetry)
+		}
+	}
+
+	// 先合并到 `.part`, 全部写完再 rename, 避免中断后留下不完整的文件
+	part := downloadPath + ".part"
+	f, err := os.OpenFile(part, os.O_TRUNC|os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for _, item := range items {
+		data, err := os.ReadFile(item.path)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrorRetry, err)
+		}
+		if key != nil {
+			if data, err = decryptAES128(data, key, k.iv); err != nil {
+				DeleteSegs(items...)
+				f.Close()
+				os.Remove(part)
+				return fmt.Errorf("[%w]: reason: '%s' path: '%s'", ErrorRetry, err.Error(), item.path)
+			}
+			for j := 0; j < len(data); j++ {
+				if data[j] == syncByte {
+					data = data[j:]
+					break
+				}
+			}
+		}
+
+		if _, err := f.Write(data); err != nil {
+			return err
+		}
+	}
+	info, _ := f.Stat()
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(part, downloadPath); err != nil {
+		return err
+	}
+	DeleteSegs(items...)
+	log.Printf("\n[SUCCESS]: 下载成功 '%s', 大小: '%s'", h.Title, utils.Bytes(uint64(info.Size())))
+	return nil
+}
+
+const (
+	syncByte = uint8(71) //0x47
+)
+
+func decryptAES128(crypted, key, iv []byte) (origData []byte, err error) {
+	defer func() {
+		e := recover()
+		switch edata := e.(type) {
+		case string:
+			err = fmt.Errorf("%s, len key: %d", edata, len(key))
+		case error:
+			err = fmt.Errorf("%w: key len: %d", edata, len(key))
+		}
+	}()
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: key len: %d", err, len(key))
+	}
+	blockSize := block.BlockSize()
+	blockMode := cipher.NewCBCDecrypter(block, iv[:blockSize])
+	origData = make([]byte, len(crypted))
+	blockMode.CryptBlocks(origData, crypted)
+	origData = pkcs5UnPadding(origData)
+	return
+}
+
+func pkcs5UnPadding(origData []byte) []byte {
+	length := len(origData)
+	unPadding := int(origData[length-1])
+	return origData[:(length - unPadding)]
+}
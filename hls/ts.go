@@ -0,0 +1,145 @@
+package hls
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const tsPacketSize = 188
+
+var ErrNoAudioStream = errors.New("ts: no audio stream found")
+
+// DemuxAudio 从 MPEG-TS 中取出第一条音频流写入 w, 返回音频文件的扩展名(.mp3/.aac)
+//
+// 如果 r 本身就是裸的 mp3/aac(HLS packed audio), 原样拷贝
+func DemuxAudio(r io.Reader, w io.Writer) (string, error) {
+	br := bufio.NewReaderSize(r, tsPacketSize*64)
+	head, err := br.Peek(4)
+	if err != nil {
+		return "", err
+	}
+	if head[0] != syncByte {
+		ext := rawAudioExt(head)
+		_, err := io.Copy(w, br)
+		return ext, err
+	}
+
+	var (
+		pmtPID   = -1
+		audioPID = -1
+		ext      string
+		inPES    bool
+		packet   = make([]byte, tsPacketSize)
+	)
+	for {
+		if _, err := io.ReadFull(br, packet); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				break
+			}
+			return "", err
+		}
+		if packet[0] != syncByte {
+			return "", fmt.Errorf("ts: lost sync byte")
+		}
+		pid := int(packet[1]&0x1f)<<8 | int(packet[2])
+		pusi := packet[1]&0x40 != 0
+		payload := packet[4:]
+		switch (packet[3] >> 4) & 0x3 {
+		case 0x2:
+			continue
+		case 0x3:
+			if int(packet[4])+1 > len(payload) {
+				continue
+			}
+			payload = payload[packet[4]+1:]
+		}
+
+		switch {
+		case pid == 0 && pusi && pmtPID < 0:
+			pmtPID = parsePAT(payload)
+		case pid == pmtPID && pusi && audioPID < 0:
+			audioPID, ext = parsePMT(payload)
+		case pid == audioPID:
+			if pusi {
+				// PES 头: 00 00 01 stream_id(1) length(2) flags(2) header_length(1)
+				if len(payload) < 9 || payload[0] != 0 || payload[1] != 0 || payload[2] != 1 {
+					inPES = false
+					continue
+				}
+				hl := 9 + int(payload[8])
+				if hl > len(payload) {
+					inPES = false
+					continue
+				}
+				payload = payload[hl:]
+				inPES = true
+			}
+			if inPES {
+				if _, err := w.Write(payload); err != nil {
+					return "", err
+				}
+			}
+		}
+	}
+	if audioPID < 0 {
+		return "", ErrNoAudioStream
+	}
+	return ext, nil
+}
+
+// section 跳过 pointer_field, 返回 section 以及 section 结束(不含 CRC)的位置
+func section(payload []byte) ([]byte, int) {
+	if len(payload) < 1 || int(payload[0])+1 > len(payload) {
+		return nil, 0
+	}
+	t := payload[payload[0]+1:]
+	if len(t) < 3 {
+		return nil, 0
+	}
+	end := 3 + (int(t[1]&0x0f)<<8 | int(t[2])) - 4
+	if end > len(t) {
+		end = len(t)
+	}
+	return t, end
+}
+
+func parsePAT(payload []byte) int {
+	t, end := section(payload)
+	for i := 8; i+4 <= end; i += 4 {
+		program := int(t[i])<<8 | int(t[i+1])
+		if program != 0 {
+			return int(t[i+2]&0x1f)<<8 | int(t[i+3])
+		}
+	}
+	return -1
+}
+
+func parsePMT(payload []byte) (int, string) {
+	t, end := section(payload)
+	if end < 12 {
+		return -1, ""
+	}
+	i := 12 + (int(t[10]&0x0f)<<8 | int(t[11]))
+	for i+5 <= end {
+		streamType := t[i]
+		pid := int(t[i+1]&0x1f)<<8 | int(t[i+2])
+		switch streamType {
+		case 0x03, 0x04:
+			return pid, ".mp3"
+		case 0x0f:
+			return pid, ".aac"
+		}
+		i += 5 + (int(t[i+3]&0x0f)<<8 | int(t[i+4]))
+	}
+	return -1, ""
+}
+
+// rawAudioExt 根据帧头判断是 ADTS(aac) 还是 mp3
+func rawAudioExt(head []byte) string {
+	if len(head) >= 2 && head[0] == 0xff && head[1]&0xf6 == 0xf0 {
+		return ".aac"
+	}
+	return ".mp3"
+}
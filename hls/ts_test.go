@@ -0,0 +1,143 @@
+package hls
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"path/filepath"
+	"testing"
+)
+
+// tsMuxer 生成最简单的单节目 TS 流: PAT + PMT + 一条音频 PES
+type tsMuxer struct {
+	bytes.Buffer
+	cc map[int]byte
+}
+
+func (m *tsMuxer) packet(pid int, pusi bool, payload []byte) []byte {
+	if m.cc == nil {
+		m.cc = map[int]byte{}
+	}
+	n := len(payload)
+	if n > tsPacketSize-4 {
+		n = tsPacketSize - 4
+	}
+	hdr := []byte{syncByte, byte(pid>>8) & 0x1f, byte(pid), 0x10 | m.cc[pid]&0x0f}
+	m.cc[pid]++
+	if pusi {
+		hdr[1] |= 0x40
+	}
+	if n < tsPacketSize-4 {
+		// 不足一个包时用 adaptation field 填充, 和真实的 muxer 一样
+		if n > tsPacketSize-6 {
+			n = tsPacketSize - 6
+		}
+		hdr[3] |= 0x20
+		stuffing := tsPacketSize - 4 - n
+		af := make([]byte, stuffing)
+		af[0] = byte(stuffing - 1)
+		if stuffing > 1 {
+			af[1] = 0x00
+			for i := 2; i < stuffing; i++ {
+				af[i] = 0xff
+			}
+		}
+		hdr = append(hdr, af...)
+	}
+	m.Write(append(hdr, payload[:n]...))
+	return payload[n:]
+}
+
+func (m *tsMuxer) pat(pmtPID int) {
+	m.packet(0, true, []byte{0x00, 0x00, 0xb0, 0x0d, 0x00, 0x01, 0xc1, 0x00, 0x00,
+		0x00, 0x01, 0xe0 | byte(pmtPID>>8), byte(pmtPID), 0, 0, 0, 0})
+}
+
+func (m *tsMuxer) pmt(pmtPID int, streamType byte, pid int) {
+	m.packet(pmtPID, true, []byte{0x00, 0x02, 0xb0, 0x12, 0x00, 0x01, 0xc1, 0x00, 0x00, 0xe1, 0x00, 0xf0, 0x00,
+		streamType, 0xe0 | byte(pid>>8), byte(pid), 0xf0, 0x00, 0, 0, 0, 0})
+}
+
+func (m *tsMuxer) pes(pid int, data []byte) {
+	// PES 头带 5 字节 PTS
+	rest := append([]byte{0x00, 0x00, 0x01, 0xc0, 0x00, 0x00, 0x80, 0x80, 0x05, 0x21, 0x00, 0x01, 0x00, 0x01}, data...)
+	for pusi := true; len(rest) > 0; pusi = false {
+		rest = m.packet(pid, pusi, rest)
+	}
+}
+
+func TestDemuxAudio(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	frames := [][]byte{make([]byte, 1000), make([]byte, 170), make([]byte, 4000)}
+	for _, f := range frames {
+		r.Read(f)
+	}
+
+	m := &tsMuxer{}
+	m.pat(0x1000)
+	m.pmt(0x1000, 0x0f, 0x101)
+	m.pes(0x100, []byte("video stream must be skipped"))
+	for _, f := range frames {
+		m.pes(0x101, f)
+	}
+
+	out := &bytes.Buffer{}
+	ext, err := DemuxAudio(bytes.NewReader(m.Bytes()), out)
+	if err != nil || ext != ".aac" {
+		t.Fatalf("DemuxAudio = %s, %v", ext, err)
+	}
+	if want := bytes.Join(frames, nil); !bytes.Equal(out.Bytes(), want) {
+		t.Errorf("got %d bytes of audio, want %d", out.Len(), len(want))
+	}
+
+	m = &tsMuxer{}
+	m.pat(0x1000)
+	m.pmt(0x1000, 0x03, 0x101)
+	m.pes(0x101, frames[0])
+	if ext, _ := DemuxAudio(bytes.NewReader(m.Bytes()), &bytes.Buffer{}); ext != ".mp3" {
+		t.Errorf("stream type 0x03: ext = %s, want .mp3", ext)
+	}
+}
+
+func TestDemuxAudioNoStream(t *testing.T) {
+	m := &tsMuxer{}
+	m.pat(0x1000)
+	m.pmt(0x1000, 0x1b, 0x100)
+	m.pes(0x100, []byte("h264"))
+	if _, err := DemuxAudio(bytes.NewReader(m.Bytes()), &bytes.Buffer{}); !errors.Is(err, ErrNoAudioStream) {
+		t.Fatalf("err = %v, want ErrNoAudioStream", err)
+	}
+}
+
+// packed audio 的 segment 不是 TS, 原样拷贝
+func TestDemuxAudioPacked(t *testing.T) {
+	adts := []byte{0xff, 0xf1, 0x50, 0x80, 0x01, 0x7f, 0xfc}
+	out := &bytes.Buffer{}
+	if ext, err := DemuxAudio(bytes.NewReader(adts), out); err != nil || ext != ".aac" || !bytes.Equal(out.Bytes(), adts) {
+		t.Errorf("adts: %s, %v", ext, err)
+	}
+	if ext, _ := DemuxAudio(bytes.NewReader([]byte("ID3\x04\x00\x00")), &bytes.Buffer{}); ext != ".mp3" {
+		t.Errorf("id3: ext = %s, want .mp3", ext)
+	}
+}
+
+func TestParsePlaylist(t *testing.T) {
+	h := &HLS{URL: "https://media.example.com/audio/1/index.m3u8?token=x", SegDir: "/tmp/segs"}
+	segs, key, err := h.parsePlaylist([]byte(`#EXTM3U
+#EXT-X-KEY:METHOD=AES-128,URI="https://example.com/key",IV=0x1f
+#EXTINF:10.0,
+seg-0.ts?sign=a
+#EXTINF:10.0,
+/other/seg-1.ts
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segs) != 2 || segs[0].fullUrl != "https://media.example.com/audio/1/seg-0.ts?sign=a" ||
+		segs[1].fullUrl != "https://media.example.com/other/seg-1.ts" || segs[0].path != filepath.Join("/tmp/segs", "seg-0.ts") {
+		t.Errorf("segs = %+v %+v", segs[0], segs[len(segs)-1])
+	}
+	if key == nil || key.uri != "https://example.com/key" || key.iv[15] != 0x1f {
+		t.Errorf("key = %+v", key)
+	}
+}
@@ -0,0 +1,257 @@
+package id3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"unicode/utf16"
+)
+
+// Tag 需要写入 mp3 的 ID3v2.3 标签
+type Tag struct {
+	Title  string
+	Album  string
+	Artist string
+
+	Track      int
+	TrackTotal int
+
+	// Cover 封面图片, CoverMIME 为空时根据内容自动识别
+	Cover     []byte
+	CoverMIME string
+}
+
+// frame 一个 ID3v2 帧, body 是原始内容, 大小在写入时根据版本重新计算
+type frame struct {
+	id    string
+	flags [2]byte
+	body  []byte
+}
+
+// frames 这里负责写入的帧, 其他已有的帧(歌词、评论、TXXX 等)写入时原样保留
+func (t *Tag) frames() []frame {
+	var frames []frame
+	frames = appendTextFrame(frames, "TIT2", t.Title)
+	frames = appendTextFrame(frames, "TALB", t.Album)
+	frames = appendTextFrame(frames, "TPE1", t.Artist)
+	if t.Track > 0 {
+		track := strconv.Itoa(t.Track)
+		if t.TrackTotal > 0 {
+			track = fmt.Sprintf("%d/%d", t.Track, t.TrackTotal)
+		}
+		frames = appendTextFrame(frames, "TRCK", track)
+	}
+	if len(t.Cover) > 0 {
+		mime := t.CoverMIME
+		if mime == "" {
+			mime = detectImageMIME(t.Cover)
+		}
+		body := &bytes.Buffer{}
+		// 编码 ISO-8859-1, MIME, 图片类型 0x03(封面), 空描述
+		body.WriteByte(0x00)
+		body.WriteString(mime)
+		body.WriteByte(0x00)
+		body.WriteByte(pictureFrontCover)
+		body.WriteByte(0x00)
+		body.Write(t.Cover)
+		frames = append(frames, frame{id: "APIC", body: body.Bytes()})
+	}
+	return frames
+}
+
+// Bytes 生成完整的 ID3v2.3 标签(包括 10 字节的头)
+func (t *Tag) Bytes() []byte {
+	return encodeTag(3, t.frames())
+}
+
+// WriteFile 更新 path 中已有的 ID3v2 标签, 只替换 Tag 中设置了的帧, 标签内容没变时不会重写文件
+func WriteFile(path string, t *Tag) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	size, err := tagSize(f)
+	if err != nil {
+		return err
+	}
+	// 标签头损坏时 size 可能超过文件大小, 继续写入会把音频内容丢掉
+	if st, err := f.Stat(); err != nil {
+		return err
+	} else if size > st.Size() {
+		return fmt.Errorf("id3: '%s' 标签大小 %d 超过文件大小 %d, 文件可能已损坏", path, size, st.Size())
+	}
+	old := make([]byte, size)
+	if _, err := f.ReadAt(old, 0); err != nil {
+		return err
+	}
+	version, frames := readFrames(old)
+	tag := encodeTag(version, mergeFrames(frames, t.frames()))
+	if bytes.Equal(old, tag) {
+		return nil
+	}
+	if _, err := f.Seek(size, io.SeekStart); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".id3-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(tag); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := io.Copy(tmp, f); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	f.Close()
+	return os.Rename(tmp.Name(), path)
+}
+
+// mergeFrames 用 owned 替换 old 中同名的帧, APIC 只替换封面, 其他类型的图片保留
+func mergeFrames(old, owned []frame) []frame {
+	ids := map[string]bool{}
+	for _, f := range owned {
+		ids[f.id] = true
+	}
+	result := owned
+	for _, f := range old {
+		if ids[f.id] && (f.id != "APIC" || pictureType(f.body) == pictureFrontCover) {
+			continue
+		}
+		result = append(result, f)
+	}
+	return result
+}
+
+const pictureFrontCover = 0x03
+
+// pictureType APIC: 编码(1) + MIME + 0x00 + 图片类型(1) + ...
+func pictureType(body []byte) int {
+	if len(body) < 2 {
+		return -1
+	}
+	i := bytes.IndexByte(body[1:], 0x00)
+	if i < 0 || 2+i >= len(body) {
+		return -1
+	}
+	return int(body[2+i])
+}
+
+// readFrames 解析已有标签中的帧, 返回标签的版本, 没有标签时为 3
+//
+// 只支持 v2.3/v2.4, v2.2 以及整个标签做了 unsynchronisation 的情况不保留原有的帧
+func readFrames(tag []byte) (byte, []frame) {
+	if len(tag) < 10 || !bytes.Equal(tag[:3], []byte("ID3")) {
+		return 3, nil
+	}
+	version, flags := tag[3], tag[5]
+	if (version != 3 && version != 4) || flags&0x80 != 0 {
+		return 3, nil
+	}
+	end := 10 + int(unsynchsafe(tag[6:10]))
+	if end > len(tag) {
+		end = len(tag)
+	}
+	pos := 10
+	if flags&0x40 != 0 && pos+4 <= end {
+		if version == 3 {
+			pos += 4 + int(binary.BigEndian.Uint32(tag[pos:]))
+		} else {
+			pos += int(unsynchsafe(tag[pos : pos+4]))
+		}
+	}
+	var frames []frame
+	for pos+10 <= end && tag[pos] != 0x00 {
+		size := int(binary.BigEndian.Uint32(tag[pos+4:]))
+		if version == 4 {
+			size = int(unsynchsafe(tag[pos+4 : pos+8]))
+		}
+		if size < 0 || pos+10+size > end {
+			break
+		}
+		frames = append(frames, frame{
+			id:    string(tag[pos : pos+4]),
+			flags: [2]byte{tag[pos+8], tag[pos+9]},
+			body:  tag[pos+10 : pos+10+size],
+		})
+		pos += 10 + size
+	}
+	return version, frames
+}
+
+// encodeTag v2.4 的帧大小也是 synchsafe 的
+func encodeTag(version byte, frames []frame) []byte {
+	bf := &bytes.Buffer{}
+	for _, f := range frames {
+		bf.WriteString(f.id)
+		if version == 4 {
+			bf.Write(synchsafe(uint32(len(f.body))))
+		} else {
+			binary.Write(bf, binary.BigEndian, uint32(len(f.body)))
+		}
+		bf.Write(f.flags[:])
+		bf.Write(f.body)
+	}
+	header := []byte{'I', 'D', '3', version, 0x00, 0x00}
+	header = append(header, synchsafe(uint32(bf.Len()))...)
+	return append(header, bf.Bytes()...)
+}
+
+// tagSize 返回文件开头已有 ID3v2 标签占用的字节数, 没有标签时为 0
+func tagSize(r io.ReaderAt) (int64, error) {
+	header := make([]byte, 10)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		if errors.Is(err, io.EOF) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	if !bytes.Equal(header[:3], []byte("ID3")) {
+		return 0, nil
+	}
+	size := int64(unsynchsafe(header[6:10])) + 10
+	// footer
+	if header[5]&0x10 != 0 {
+		size += 10
+	}
+	return size, nil
+}
+
+func appendTextFrame(frames []frame, id, text string) []frame {
+	if text == "" {
+		return frames
+	}
+	// UTF-16 带 BOM, 中文标题在各个播放器里都能正常显示
+	body := []byte{0x01, 0xff, 0xfe}
+	for _, u := range utf16.Encode([]rune(text)) {
+		body = append(body, byte(u), byte(u>>8))
+	}
+	return append(frames, frame{id: id, body: body})
+}
+
+func synchsafe(n uint32) []byte {
+	return []byte{byte(n >> 21 & 0x7f), byte(n >> 14 & 0x7f), byte(n >> 7 & 0x7f), byte(n & 0x7f)}
+}
+
+func unsynchsafe(b []byte) uint32 {
+	return uint32(b[0]&0x7f)<<21 | uint32(b[1]&0x7f)<<14 | uint32(b[2]&0x7f)<<7 | uint32(b[3]&0x7f)
+}
+
+func detectImageMIME(data []byte) string {
+	if bytes.HasPrefix(data, []byte("\x89PNG")) {
+		return "image/png"
+	}
+	return "image/jpeg"
+}
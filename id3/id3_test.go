@@ -0,0 +1,106 @@
+package id3
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// mp3 的帧头 + 一些数据, 写标签前后必须保持不变
+var audio = append([]byte{0xff, 0xfb, 0x90, 0x64}, bytes.Repeat([]byte{0x55}, 1020)...)
+
+func writeMP3(t *testing.T, tag []byte) string {
+	p := filepath.Join(t.TempDir(), "01.mp3")
+	if err := os.WriteFile(p, append(append([]byte(nil), tag...), audio...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func picture(kind byte, data string) []byte {
+	return append([]byte{0x00, 'i', 'm', 'a', 'g', 'e', '/', 'j', 'p', 'e', 'g', 0x00, kind, 0x00}, data...)
+}
+
+func readTag(t *testing.T, p string) (byte, map[string][][]byte) {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size, _ := tagSize(bytes.NewReader(data))
+	if !bytes.Equal(data[size:], audio) {
+		t.Fatal("audio data changed")
+	}
+	version, frames := readFrames(data[:size])
+	m := map[string][][]byte{}
+	for _, f := range frames {
+		m[f.id] = append(m[f.id], f.body)
+	}
+	return version, m
+}
+
+func TestWriteFileKeepsOtherFrames(t *testing.T) {
+	for _, version := range []byte{3, 4} {
+		// 其他软件写入的标签: 歌词、评论、自定义字段、艺术家照片和旧的封面
+		p := writeMP3(t, encodeTag(version, []frame{
+			{id: "TIT2", body: []byte("\x00old title")},
+			{id: "USLT", body: []byte("\x00chi\x00lyrics")},
+			{id: "COMM", body: []byte("\x00chi\x00comment")},
+			{id: "TXXX", body: []byte("\x00source\x00geekbang")},
+			{id: "APIC", body: picture(0x08, "artist")},
+			{id: "APIC", body: picture(0x03, "old cover")},
+		}))
+		tag := &Tag{Title: "01 | 开篇词", Album: "专栏", Track: 1, TrackTotal: 10, Cover: []byte("\xff\xd8new cover")}
+		if err := WriteFile(p, tag); err != nil {
+			t.Fatal(err)
+		}
+
+		got, frames := readTag(t, p)
+		if got != version {
+			t.Errorf("v2.%d tag written as v2.%d", version, got)
+		}
+		for _, id := range []string{"USLT", "COMM", "TXXX", "TALB", "TRCK"} {
+			if len(frames[id]) != 1 {
+				t.Errorf("v2.%d: %s frames = %d, want 1", version, id, len(frames[id]))
+			}
+		}
+		if len(frames["TIT2"]) != 1 || bytes.Contains(frames["TIT2"][0], []byte("old")) {
+			t.Errorf("v2.%d: title not replaced: %q", version, frames["TIT2"])
+		}
+		if apic := frames["APIC"]; len(apic) != 2 || !bytes.HasSuffix(apic[0], tag.Cover) || !bytes.HasSuffix(apic[1], []byte("artist")) {
+			t.Errorf("v2.%d: only the front cover should be replaced: %q", version, apic)
+		}
+	}
+}
+
+func TestWriteFileUnchanged(t *testing.T) {
+	p := writeMP3(t, nil)
+	tag := &Tag{Title: "标题", Artist: "讲师", Track: 3}
+	if err := WriteFile(p, tag); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(p, old, old)
+	if err := WriteFile(p, tag); err != nil {
+		t.Fatal(err)
+	}
+	if st, _ := os.Stat(p); !st.ModTime().Equal(old) {
+		t.Error("file rewritten although the tag did not change")
+	}
+	if _, frames := readTag(t, p); len(frames) != 3 {
+		t.Errorf("frames = %v", frames)
+	}
+}
+
+func TestWriteFileCorruptHeader(t *testing.T) {
+	// 标签大小声明为 256MB, 比文件大得多
+	p := writeMP3(t, []byte("ID3\x03\x00\x00\x7f\x7f\x7f\x7f"))
+	before, _ := os.ReadFile(p)
+	if err := WriteFile(p, &Tag{Title: "x"}); err == nil {
+		t.Fatal("want error for tag size larger than file")
+	}
+	if after, _ := os.ReadFile(p); !bytes.Equal(before, after) {
+		t.Error("file should be left untouched")
+	}
+}
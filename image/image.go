@@ -3,15 +3,14 @@ package image
 import (
 	"context"
 	"fmt"
-	"io"
-	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
 
-	"github.com/duc-cnzj/geekbang2md/constant"
+	"github.com/duc-cnzj/geekbang2md/downloader"
+	"github.com/duc-cnzj/geekbang2md/retry"
 	"github.com/duc-cnzj/geekbang2md/waiter"
 )
 
@@ -19,7 +18,6 @@ type Manager struct {
 	sync.RWMutex
 	images  map[string]string
 	baseDir string
-	waiter  waiter.Interface
 }
 
 func NewManager(baseDir string) *Manager {
@@ -29,7 +27,6 @@ func NewManager(baseDir string) *Manager {
 		RWMutex: sync.RWMutex{},
 		images:  map[string]string{},
 		baseDir: baseDir,
-		waiter:  waiter.NewSigWaiter(constant.ImageDownloadParallelNum),
 	}
 }
 
@@ -42,20 +39,17 @@ func (m *Manager) Download(u string, articleNumber string) (string, error) {
 		return "", err
 	}
 	stat, err := os.Stat(p)
-	if err == nil && stat.Mode().IsRegular() && stat.Size() > 10 {
+	if err == nil && stat.Mode().IsRegular() && stat.Size() > 0 {
 		m.Add(u, p)
 		return p, nil
 	}
-	m.waiter.Wait(context.TODO())
-	defer m.waiter.Release()
-	c := &http.Client{}
-	res, err := c.Get(u)
-	if err != nil {
-		return "", err
-	}
-	defer res.Body.Close()
-	all, _ := io.ReadAll(res.Body)
-	if err := os.WriteFile(p, all, 0644); err != nil {
+	limiter := waiter.Default.ForURL(u, waiter.ClassAsset)
+	limiter.Wait(context.TODO())
+	defer limiter.Release()
+	if err := retry.Do(u, func() error {
+		_, err := downloader.Default.Download(u, p)
+		return err
+	}); err != nil {
 		return "", fmt.Errorf("err: %w, origin path: %s, write path: %s", err, u, p)
 	}
 	m.Add(u, p)
@@ -82,6 +76,11 @@ func (m *Manager) FullLocalPath(u string, articleNumber string) (string, error)
 	return p, nil
 }
 
+// AudioPath 音频文件在 mp3 目录下的路径
+func (m *Manager) AudioPath(name string) string {
+	return filepath.Join(m.baseDir, "mp3", name)
+}
+
 func (m *Manager) Has(url string) bool {
 	m.RLock()
 	defer m.RUnlock()
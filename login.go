@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/duc-cnzj/geekbang2md/api"
+	"github.com/duc-cnzj/geekbang2md/cache"
+	"github.com/duc-cnzj/geekbang2md/session"
+	"github.com/duc-cnzj/geekbang2md/utils"
+)
+
+var sessionStore *session.Store
+
+func openSession() {
+	sessionStore = session.NewStore(profile.SessionPath(), keyFile)
+	api.HttpClient.SetRefresher(refreshSession)
+}
+
+// refreshSession 运行过程中登录过期时, 先尝试其他进程保存的最新登录信息
+func refreshSession() error {
+	sess, err := sessionStore.Load()
+	if err != nil {
+		return err
+	}
+	api.HttpClient.ClearCookies()
+	api.HttpClient.SetCookies(sess.Cookies)
+	_, err = userAuth()
+	return err
+}
+
+// login 指定了 -cookie/-cookie-file/-sms/-u/-p 时按指定方式登录, 否则优先使用保存的登录信息
+func login(force bool) (*api.AuthInfo, error) {
+	var (
+		u   *api.AuthInfo
+		err error
+	)
+	switch {
+	case cookie != "":
+		api.HttpClient.SetCookies((&http.Request{Header: http.Header{"Cookie": {cookie}}}).Cookies())
+		u, err = userAuth()
+	case cookieFile != "":
+		cookies, e := session.ReadCookieFile(cookieFile)
+		if e != nil {
+			return nil, e
+		}
+		api.HttpClient.SetCookies(cookies)
+		u, err = userAuth()
+	case sms:
+		u, err = smsLogin()
+	case force || username != "" || password != "":
+		u, err = passwordLogin()
+	default:
+		if u, err = restoreSession(); err == nil {
+			break
+		}
+		if !errors.Is(err, session.ErrNoSession) {
+			log.Println("保存的登录信息不可用:", err)
+		}
+		u, err = passwordLogin()
+	}
+	if err != nil {
+		return nil, err
+	}
+	saveSession(u)
+	return u, nil
+}
+
+func userAuth() (*api.AuthInfo, error) {
+	ti, err := api.HttpClient.Time()
+	if err != nil {
+		return nil, err
+	}
+	return api.HttpClient.UserAuth(ti.Data * 1000)
+}
+
+// restoreSession 使用保存的 cookie, 并通过 UserAuth 校验是否还有效
+func restoreSession() (*api.AuthInfo, error) {
+	sess, err := sessionStore.Load()
+	if err != nil {
+		return nil, err
+	}
+	api.HttpClient.SetCookies(sess.Cookies)
+	if username == "" {
+		username = sess.Phone
+	}
+	return userAuth()
+}
+
+// saveSession 登录成功以及下载结束后都会保存一次, 服务端刷新过的 cookie 也能保存下来
+func saveSession(u *api.AuthInfo) {
+	if err := sessionStore.Save(&session.Session{
+		Phone:   username,
+		Nick:    u.Data.Nick,
+		Cookies: api.HttpClient.Cookies(),
+	}); err != nil {
+		log.Println("保存登录信息失败:", err)
+	}
+	profile.Nick = u.Data.Nick
+	if err := profile.Save(); err != nil {
+		log.Println("保存账号配置失败:", err)
+	}
+	legacyCookiesOnce.Do(removeLegacyCookies)
+}
+
+var legacyCookiesOnce sync.Once
+
+// removeLegacyCookies 之前的版本把短信登录的 cookie 明文保存在缓存目录, 现在已经加密保存在 session 中
+func removeLegacyCookies() {
+	removed, err := (&cache.Cache{}).RemovePrefix("sms-cookies-")
+	for _, m := range removed {
+		log.Printf("已删除旧版本明文保存的 cookie: %s\n", m.Key)
+	}
+	if err != nil {
+		log.Println("删除明文保存的 cookie 失败:", err)
+	}
+}
+
+func askUsername() {
+	if username == "" {
+		fmt.Printf("用户名: ")
+		fmt.Scanln(&username)
+	}
+}
+
+func passwordLogin() (*api.AuthInfo, error) {
+	askUsername()
+	api.HttpClient.SetPhone(username)
+	if password == "" {
+		password = utils.ReadPassword("密码: ")
+	}
+	api.HttpClient.SetPassword(password)
+
+	u, err := api.HttpClient.Login(username, password)
+	if errors.Is(err, api.ErrCaptchaRequired) {
+		return nil, fmt.Errorf("%w\n需要验证码, 请使用 -sms 或者 -cookie 登录", err)
+	}
+	return u, err
+}
+
+func smsLogin() (*api.AuthInfo, error) {
+	askUsername()
+	if err := api.HttpClient.SendSMSCode(username); err != nil {
+		if errors.Is(err, api.ErrCaptchaRequired) {
+			return nil, fmt.Errorf("%w\n需要图形验证码, 请在浏览器中登录后使用 -cookie 导入 cookie", err)
+		}
+		return nil, err
+	}
+	var code string
+	fmt.Printf("验证码已发送到 %s, 请输入验证码: ", username)
+	fmt.Scanln(&code)
+	return api.HttpClient.LoginBySMS(username, code)
+}
+
+func loginCommand() {
+	u, err := login(true)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	log.Printf("登录成功: %s, 登录信息保存在 %s\n", u.Data.Nick, sessionStore.Path())
+}
+
+func logoutCommand() {
+	if err := sessionStore.Delete(); err != nil {
+		log.Fatalln(err)
+	}
+	log.Println("已退出登录")
+}
+
+func whoamiCommand() {
+	u, err := restoreSession()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	saveSession(u)
+	log.Printf("%s (uid: %d)\n", u.Data.Nick, u.Data.UID)
+}
@@ -1,6 +1,7 @@
-package zhuanlan
+package markdown
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -9,6 +10,7 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/duc-cnzj/geekbang2md/api"
 	"github.com/duc-cnzj/geekbang2md/image"
 	"github.com/duc-cnzj/geekbang2md/utils"
 
@@ -17,6 +19,7 @@ import (
 
 var imgRegexp = regexp.MustCompile(`!\[(.*?)]\((.*?)\)`)
 
+// MDWriter 把文章的 html 转换成 markdown, 图片和音频下载到本地后替换成相对路径, 专栏和视频共用
 type MDWriter struct {
 	title        string
 	baseDir      string
@@ -28,6 +31,11 @@ func NewMDWriter(baseDir, title string, imgM *image.Manager) *MDWriter {
 	return &MDWriter{baseDir: baseDir, imageManager: imgM, title: title}
 }
 
+// BaseDir markdown 文件所在的目录
+func (w *MDWriter) BaseDir() string {
+	return w.baseDir
+}
+
 func (w *MDWriter) GetFileName(filename string) string {
 	filename = utils.FilterCharacters(filename)
 	name := filepath.Join(w.baseDir, filename)
@@ -72,7 +80,10 @@ func (w *MDWriter) WriteFile(articleNumber, audioDownloadURL, audioDubber, audio
 			}
 			download, err := w.imageManager.Download(s, articleNumber)
 			if err != nil {
-				log.Println(err)
+				// 离线模式下没有下载过的图片保留原来的地址
+				if !errors.Is(err, api.ErrOffline) {
+					log.Println(err)
+				}
 			} else {
 				rel, _ := filepath.Rel(w.baseDir, download)
 				ss.Replace(s, rel)
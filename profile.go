@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/duc-cnzj/geekbang2md/session"
+)
+
+var (
+	profile *session.Profile
+	// parsedFlags 实际解析命令行的 FlagSet, cache 子命令使用单独的 FlagSet
+	parsedFlags = flag.CommandLine
+)
+
+// loadProfile 指定了 -dir 时记到账号配置里, 否则使用账号上次的下载目录
+func loadProfile() {
+	var err error
+	if profile, err = session.LoadProfile(profileName); err != nil {
+		log.Fatalln(err)
+	}
+	var dirSet bool
+	parsedFlags.Visit(func(f *flag.Flag) {
+		if f.Name == "dir" {
+			dirSet = true
+		}
+	})
+	switch {
+	case dirSet:
+		profile.Dir = dir
+	case profile.Dir != "":
+		dir = profile.Dir
+	}
+}
+
+func profilesCommand() {
+	profiles, err := session.Profiles()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if len(profiles) == 0 {
+		log.Println("还没有保存过任何账号")
+		return
+	}
+	for _, p := range profiles {
+		nick := p.Nick
+		if nick == "" {
+			nick = "-"
+		}
+		d := p.Dir
+		if d == "" {
+			d = "-"
+		}
+		log.Printf("%-16s 用户: %-16s 下载目录: %s\n", p.Name, nick, d)
+	}
+}
@@ -0,0 +1,146 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+// ErrRetry 包装了 ErrRetry 的错误一定会重试
+var ErrRetry = errors.New("retry")
+
+// Policy 重试策略, 每次重试的间隔按 Multiplier 指数增长, 并加上 ±RandomizationFactor 的随机抖动
+type Policy struct {
+	MaxAttempts         int
+	InitialInterval     time.Duration
+	MaxInterval         time.Duration
+	Multiplier          float64
+	RandomizationFactor float64
+}
+
+// Default api、图片、音频、视频共用的重试策略
+var Default = &Policy{
+	MaxAttempts:         4,
+	InitialInterval:     time.Second,
+	MaxInterval:         30 * time.Second,
+	Multiplier:          2,
+	RandomizationFactor: 0.5,
+}
+
+var stats struct {
+	retries, recovered, failed int64
+}
+
+// Stats retries 总的重试次数, recovered 重试后成功的次数, failed 重试后仍然失败的次数
+func Stats() (retries, recovered, failed int64) {
+	return atomic.LoadInt64(&stats.retries), atomic.LoadInt64(&stats.recovered), atomic.LoadInt64(&stats.failed)
+}
+
+func Do(name string, fn func() error) error {
+	return Default.Do(name, fn)
+}
+
+// Do 执行 fn 直到成功、遇到不可重试的错误或者达到最大次数, name 用于日志
+func (p *Policy) Do(name string, fn func() error) error {
+	var attempts int
+	err := backoff.RetryNotify(func() error {
+		attempts++
+		err := fn()
+		if err != nil && !Retryable(err) {
+			return backoff.Permanent(err)
+		}
+		return err
+	}, p.backOff(), func(err error, d time.Duration) {
+		atomic.AddInt64(&stats.retries, 1)
+		log.Printf("[RETRY]: '%s' 第 %d 次失败: %v, %s 后重试\n", name, attempts, err, d.Round(time.Millisecond))
+	})
+	if attempts > 1 {
+		if err == nil {
+			atomic.AddInt64(&stats.recovered, 1)
+		} else {
+			atomic.AddInt64(&stats.failed, 1)
+		}
+	}
+	return err
+}
+
+// WithMaxAttempts 复制一份策略, 只修改最大次数
+func (p *Policy) WithMaxAttempts(n int) *Policy {
+	cp := *p
+	cp.MaxAttempts = n
+	return &cp
+}
+
+func (p *Policy) backOff() backoff.BackOff {
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = p.InitialInterval
+	b.MaxInterval = p.MaxInterval
+	b.Multiplier = p.Multiplier
+	b.RandomizationFactor = p.RandomizationFactor
+	b.MaxElapsedTime = 0
+	attempts := p.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	return backoff.WithMaxRetries(b, uint64(attempts-1))
+}
+
+// Permanent 不再重试
+func Permanent(err error) error {
+	return backoff.Permanent(err)
+}
+
+// Retryable 超时、连接被重置、5xx 等临时错误可以重试, 4xx(包括登录失效)不重试,
+// 错误实现了 `Retryable() bool` 时以它为准
+func Retryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var permanent *backoff.PermanentError
+	if errors.As(err, &permanent) {
+		return false
+	}
+	if errors.Is(err, ErrRetry) {
+		return true
+	}
+	var r interface{ Retryable() bool }
+	if errors.As(err, &r) {
+		return r.Retryable()
+	}
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return true
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return true
+	}
+	return errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE)
+}
+
+// StatusError 非 2xx 的响应
+type StatusError struct {
+	URL        string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("'%s': unexpected status %d", e.URL, e.StatusCode)
+}
+
+func (e *StatusError) Retryable() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusRequestTimeout || e.StatusCode == http.StatusTooManyRequests
+}
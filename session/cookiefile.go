@@ -0,0 +1,153 @@
+package session
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CookieDomains 只导入这些域名下的 cookie
+var CookieDomains = []string{"geekbang.org", "infoq.cn"}
+
+// ReadCookieFile 读取浏览器导出的 cookie, 支持 Netscape cookies.txt 和浏览器插件导出的 JSON
+func ReadCookieFile(path string) ([]*http.Cookie, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cookies []*http.Cookie
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && (trimmed[0] == '[' || trimmed[0] == '{') {
+		cookies, err = parseJSONCookies(trimmed)
+	} else {
+		cookies, err = parseNetscapeCookies(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*http.Cookie
+	now := time.Now()
+	for _, c := range cookies {
+		if !matchDomain(c.Domain) || (!c.Expires.IsZero() && c.Expires.Before(now)) {
+			continue
+		}
+		result = append(result, c)
+	}
+	if len(result) == 0 {
+		return nil, errors.New("cookie 文件中没有找到 geekbang.org/infoq.cn 的 cookie")
+	}
+	return result, nil
+}
+
+func matchDomain(domain string) bool {
+	domain = strings.TrimPrefix(strings.ToLower(domain), ".")
+	for _, d := range CookieDomains {
+		if domain == d || strings.HasSuffix(domain, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseNetscapeCookies 每行: domain includeSubdomains path secure expires name value
+func parseNetscapeCookies(data []byte) ([]*http.Cookie, error) {
+	var cookies []*http.Cookie
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		var httpOnly bool
+		if strings.HasPrefix(line, "#HttpOnly_") {
+			line = strings.TrimPrefix(line, "#HttpOnly_")
+			httpOnly = true
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) < 7 {
+			continue
+		}
+		c := &http.Cookie{
+			Domain:   fields[0],
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			Name:     fields[5],
+			Value:    fields[6],
+			HttpOnly: httpOnly,
+		}
+		// includeSubdomains 为 FALSE 时是 host-only cookie
+		if !strings.EqualFold(fields[1], "TRUE") {
+			c.Domain = strings.TrimPrefix(c.Domain, ".")
+		}
+		if expires, err := strconv.ParseInt(fields[4], 10, 64); err == nil && expires > 0 {
+			c.Expires = time.Unix(expires, 0)
+		}
+		cookies = append(cookies, c)
+	}
+	return cookies, scanner.Err()
+}
+
+type jsonCookie struct {
+	Domain         string  `json:"domain"`
+	Name           string  `json:"name"`
+	Value          string  `json:"value"`
+	Path           string  `json:"path"`
+	Secure         bool    `json:"secure"`
+	HttpOnly       bool    `json:"httpOnly"`
+	HostOnly       bool    `json:"hostOnly"`
+	Session        bool    `json:"session"`
+	ExpirationDate float64 `json:"expirationDate"`
+	Expires        float64 `json:"expires"`
+}
+
+// parseJSONCookies 兼容 EditThisCookie/Cookie-Editor 导出的数组, 以及 {"cookies": [...]} 格式
+func parseJSONCookies(data []byte) ([]*http.Cookie, error) {
+	var items []jsonCookie
+	if data[0] == '{' {
+		var wrapper struct {
+			Cookies []jsonCookie `json:"cookies"`
+		}
+		if err := json.Unmarshal(data, &wrapper); err != nil {
+			return nil, err
+		}
+		items = wrapper.Cookies
+	} else if err := json.Unmarshal(data, &items); err != nil {
+		return nil, err
+	}
+
+	cookies := make([]*http.Cookie, 0, len(items))
+	for _, item := range items {
+		c := &http.Cookie{
+			Domain:   item.Domain,
+			Name:     item.Name,
+			Value:    item.Value,
+			Path:     item.Path,
+			Secure:   item.Secure,
+			HttpOnly: item.HttpOnly,
+		}
+		if item.HostOnly {
+			c.Domain = strings.TrimPrefix(c.Domain, ".")
+		}
+		if c.Path == "" {
+			c.Path = "/"
+		}
+		expires := item.ExpirationDate
+		if expires == 0 {
+			expires = item.Expires
+		}
+		if !item.Session && expires > 0 {
+			sec, frac := math.Modf(expires)
+			c.Expires = time.Unix(int64(sec), int64(frac*1e9))
+		}
+		cookies = append(cookies, c)
+	}
+	return cookies, nil
+}
@@ -0,0 +1,85 @@
+package session
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// sentCookies 把导入的 cookie 放进 jar, 返回访问 u 时会带上的 cookie, 这才是导入后真正生效的结果
+func sentCookies(cookies []*http.Cookie, u string) string {
+	jar, _ := cookiejar.New(nil)
+	for _, c := range cookies {
+		host := strings.TrimPrefix(c.Domain, ".")
+		jar.SetCookies(&url.URL{Scheme: "https", Host: host, Path: c.Path}, []*http.Cookie{c})
+	}
+	parse, _ := url.Parse(u)
+	var pairs []string
+	for _, c := range jar.Cookies(parse) {
+		pairs = append(pairs, c.Name+"="+c.Value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "; ")
+}
+
+func TestReadCookieFile(t *testing.T) {
+	for _, name := range []string{"cookies.txt", "cookies.json"} {
+		cookies, err := ReadCookieFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(cookies) != 3 {
+			t.Errorf("%s: got %d cookies, expired and foreign cookies should be dropped", name, len(cookies))
+		}
+		if got := sentCookies(cookies, "https://time.geekbang.org/serv/v1/column/articles"); got != "GCESS=gcess; GCID=gcid; SERVERID=sid" {
+			t.Errorf("%s: time.geekbang.org/serv gets %q", name, got)
+		}
+		// SERVERID 是 host-only 的, 子域名和其他路径都不应该带上
+		if got := sentCookies(cookies, "https://account.geekbang.org/account/ticket/login"); got != "GCESS=gcess; GCID=gcid" {
+			t.Errorf("%s: account.geekbang.org gets %q", name, got)
+		}
+		for _, c := range cookies {
+			switch c.Name {
+			case "GCID":
+				if !c.Secure || c.Expires.Year() != 2100 {
+					t.Errorf("%s: GCID = %+v", name, c)
+				}
+			case "GCESS":
+				if !c.HttpOnly || !c.Expires.IsZero() {
+					t.Errorf("%s: GCESS = %+v", name, c)
+				}
+			}
+		}
+	}
+}
+
+func TestReadCookieFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	foreign := filepath.Join(dir, "foreign.txt")
+	os.WriteFile(foreign, []byte(".example.com\tTRUE\t/\tFALSE\t0\tOTHER\tx\n"), 0600)
+	if _, err := ReadCookieFile(foreign); err == nil {
+		t.Error("want error when no geekbang cookie found")
+	}
+	broken := filepath.Join(dir, "broken.json")
+	os.WriteFile(broken, []byte(`[{"domain": `), 0600)
+	if _, err := ReadCookieFile(broken); err == nil {
+		t.Error("want error for broken json")
+	}
+	if _, err := ReadCookieFile(filepath.Join(dir, "missing")); !os.IsNotExist(err) {
+		t.Errorf("err = %v, want not exist", err)
+	}
+}
+
+func TestMatchDomain(t *testing.T) {
+	if !matchDomain(".Time.GeekBang.org") || !matchDomain("infoq.cn") {
+		t.Error("geekbang/infoq domains should match")
+	}
+	if matchDomain("notgeekbang.org") || matchDomain("geekbang.org.evil.com") {
+		t.Error("lookalike domains should not match")
+	}
+}
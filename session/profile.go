@@ -0,0 +1,113 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+)
+
+// DefaultProfile 没有指定 -profile 时使用的账号, 文件直接放在 Dir() 下, 兼容之前的版本
+const DefaultProfile = "default"
+
+var profileNameRegexp = regexp.MustCompile(`^[\w-]+$`)
+
+// Profile 账号的配置, 明文保存, 不包含任何登录凭证
+type Profile struct {
+	Name string `json:"name"`
+	Nick string `json:"nick"`
+	Dir  string `json:"dir"`
+}
+
+func profileDir(name string) string {
+	if name == DefaultProfile {
+		return Dir()
+	}
+	return filepath.Join(Dir(), "profiles", name)
+}
+
+// LoadProfile 加载账号配置, 不存在时返回一个空的配置
+func LoadProfile(name string) (*Profile, error) {
+	if name == "" {
+		name = DefaultProfile
+	}
+	if !profileNameRegexp.MatchString(name) {
+		return nil, fmt.Errorf("profile 名称 '%s' 只能包含字母、数字、下划线和中划线", name)
+	}
+	p := &Profile{Name: name}
+	data, err := os.ReadFile(filepath.Join(profileDir(name), "profile.json"))
+	if os.IsNotExist(err) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, err
+	}
+	p.Name = name
+	return p, nil
+}
+
+func (p *Profile) Save() error {
+	marshal, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(profileDir(p.Name), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(profileDir(p.Name), "profile.json"), marshal, 0600)
+}
+
+// SessionPath 每个账号的登录信息单独保存
+func (p *Profile) SessionPath() string {
+	return p.File("session")
+}
+
+// File 账号目录下的文件
+func (p *Profile) File(name string) string {
+	return filepath.Join(profileDir(p.Name), name)
+}
+
+// CacheNamespace 默认账号不使用子目录, 兼容之前的缓存
+func (p *Profile) CacheNamespace() string {
+	if p.Name == DefaultProfile {
+		return ""
+	}
+	return p.Name
+}
+
+// Profiles 列出所有保存过的账号
+func Profiles() ([]*Profile, error) {
+	var names []string
+	if _, err := os.Stat(filepath.Join(Dir(), "profile.json")); err == nil {
+		names = append(names, DefaultProfile)
+	} else if _, err := os.Stat(filepath.Join(Dir(), "session")); err == nil {
+		names = append(names, DefaultProfile)
+	}
+	entries, err := os.ReadDir(filepath.Join(Dir(), "profiles"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var others []string
+	for _, entry := range entries {
+		if entry.IsDir() && profileNameRegexp.MatchString(entry.Name()) {
+			others = append(others, entry.Name())
+		}
+	}
+	sort.Strings(others)
+	names = append(names, others...)
+
+	profiles := make([]*Profile, 0, len(names))
+	for _, name := range names {
+		p, err := LoadProfile(name)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, p)
+	}
+	return profiles, nil
+}
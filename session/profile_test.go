@@ -0,0 +1,73 @@
+package session
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func setConfigDir(t *testing.T) string {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("AppData", filepath.Join(home, "AppData"))
+	t.Setenv(PassphraseEnv, "")
+	return Dir()
+}
+
+// 每个账号的登录信息分开保存, 默认账号兼容之前直接放在 Dir() 下的文件
+func TestProfileSessions(t *testing.T) {
+	dir := setConfigDir(t)
+	def, err := LoadProfile("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice, _ := LoadProfile("alice")
+	if def.SessionPath() != filepath.Join(dir, "session") || alice.SessionPath() != filepath.Join(dir, "profiles", "alice", "session") {
+		t.Fatalf("session paths: %s, %s", def.SessionPath(), alice.SessionPath())
+	}
+	if def.CacheNamespace() != "" || alice.CacheNamespace() != "alice" {
+		t.Errorf("cache namespaces: %q, %q", def.CacheNamespace(), alice.CacheNamespace())
+	}
+
+	save := func(p *Profile, value string) {
+		t.Helper()
+		sess := &Session{Phone: p.Name, Cookies: []*http.Cookie{{Name: "GCESS", Value: value, Domain: ".geekbang.org"}}}
+		if err := NewStore(p.SessionPath(), "").Save(sess); err != nil {
+			t.Fatal(err)
+		}
+	}
+	save(def, "default-cookie")
+	if _, err := NewStore(alice.SessionPath(), "").Load(); !errors.Is(err, ErrNoSession) {
+		t.Fatalf("alice: err = %v, want ErrNoSession before login", err)
+	}
+	save(alice, "alice-cookie")
+	alice.Nick = "Alice"
+	if err := alice.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	for p, want := range map[*Profile]string{def: "default-cookie", alice: "alice-cookie"} {
+		sess, err := NewStore(p.SessionPath(), "").Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sess.Cookies) != 1 || sess.Cookies[0].Value != want {
+			t.Errorf("%s: cookies = %+v, want %s", p.Name, sess.Cookies, want)
+		}
+	}
+	// 所有账号共用 Dir() 下的 session.key
+	if _, err := os.Stat(filepath.Join(dir, "session.key")); err != nil {
+		t.Error(err)
+	}
+
+	profiles, err := Profiles()
+	if err != nil || len(profiles) != 2 || profiles[0].Name != DefaultProfile || profiles[1].Nick != "Alice" {
+		t.Errorf("Profiles = %+v, %v", profiles, err)
+	}
+	if _, err := LoadProfile("../alice"); err == nil {
+		t.Error("want error for invalid profile name")
+	}
+}
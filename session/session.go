@@ -0,0 +1,195 @@
+package session
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// PassphraseEnv 设置了这个环境变量时使用口令加密, 否则使用 key 文件
+const PassphraseEnv = "GEEKBANG2MD_PASSPHRASE"
+
+var (
+	ErrNoSession     = errors.New("session: 没有保存的登录信息")
+	ErrBadPassphrase = errors.New("session: 解密失败, 口令或者 key 文件不正确")
+)
+
+var magic = []byte("GB2MDS1")
+
+const (
+	modeKeyFile    byte = 0
+	modePassphrase byte = 1
+	saltSize            = 16
+)
+
+// Session 保存的登录态
+type Session struct {
+	Phone   string         `json:"phone"`
+	Nick    string         `json:"nick"`
+	Cookies []*http.Cookie `json:"cookies"`
+	SavedAt time.Time      `json:"saved_at"`
+}
+
+// Store 加密保存在用户配置目录下的登录态
+type Store struct {
+	path       string
+	keyFile    string
+	passphrase string
+}
+
+// Dir 默认的配置目录, 例如 ~/.config/geekbang2md
+func Dir() string {
+	d, err := os.UserConfigDir()
+	if err != nil {
+		d = os.TempDir()
+	}
+	return filepath.Join(d, "geekbang2md")
+}
+
+// NewStore keyFile 为空时使用 Dir() 下的 session.key, 不存在会自动生成
+func NewStore(path, keyFile string) *Store {
+	if keyFile == "" {
+		keyFile = filepath.Join(Dir(), "session.key")
+	}
+	return &Store{path: path, keyFile: keyFile, passphrase: os.Getenv(PassphraseEnv)}
+}
+
+func (s *Store) Path() string {
+	return s.path
+}
+
+func (s *Store) Load() (*Session, error) {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, ErrNoSession
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < len(magic)+1+saltSize || !bytes.Equal(data[:len(magic)], magic) {
+		return nil, fmt.Errorf("session: '%s' 文件格式不正确", s.path)
+	}
+	mode := data[len(magic)]
+	salt := data[len(magic)+1 : len(magic)+1+saltSize]
+	gcm, err := s.aead(mode, salt, false)
+	if err != nil {
+		return nil, err
+	}
+	sealed := data[len(magic)+1+saltSize:]
+	if len(sealed) < gcm.NonceSize() {
+		return nil, ErrBadPassphrase
+	}
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], magic)
+	if err != nil {
+		return nil, ErrBadPassphrase
+	}
+	sess := &Session{}
+	if err := json.Unmarshal(plain, sess); err != nil {
+		return nil, err
+	}
+	return sess, nil
+}
+
+func (s *Store) Save(sess *Session) error {
+	sess.SavedAt = time.Now()
+	plain, err := json.Marshal(sess)
+	if err != nil {
+		return err
+	}
+	mode := modeKeyFile
+	if s.passphrase != "" {
+		mode = modePassphrase
+	}
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return err
+	}
+	gcm, err := s.aead(mode, salt, true)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	bf := bytes.NewBuffer(append([]byte{}, magic...))
+	bf.WriteByte(mode)
+	bf.Write(salt)
+	bf.Write(nonce)
+	bf.Write(gcm.Seal(nil, nonce, plain, magic))
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, bf.Bytes(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func (s *Store) Delete() error {
+	if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *Store) aead(mode byte, salt []byte, create bool) (cipher.AEAD, error) {
+	var (
+		key []byte
+		err error
+	)
+	switch mode {
+	case modePassphrase:
+		if s.passphrase == "" {
+			return nil, fmt.Errorf("session: 登录信息使用口令加密, 请设置环境变量 %s", PassphraseEnv)
+		}
+		key, err = scrypt.Key([]byte(s.passphrase), salt, 1<<15, 8, 1, 32)
+	default:
+		key, err = s.readKeyFile(create)
+	}
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (s *Store) readKeyFile(create bool) ([]byte, error) {
+	key, err := os.ReadFile(s.keyFile)
+	if err == nil {
+		if len(key) != 32 {
+			return nil, fmt.Errorf("session: key 文件 '%s' 必须是 32 字节", s.keyFile)
+		}
+		return key, nil
+	}
+	if !os.IsNotExist(err) || !create {
+		return nil, err
+	}
+	key = make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.keyFile), 0700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(s.keyFile, key, 0600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
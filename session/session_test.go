@@ -0,0 +1,114 @@
+package session
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testSession() *Session {
+	return &Session{
+		Phone:   "13800000000",
+		Nick:    "geek",
+		Cookies: []*http.Cookie{{Name: "GCESS", Value: "secret-cookie-value", Domain: ".geekbang.org", Path: "/"}},
+	}
+}
+
+func TestStoreKeyFile(t *testing.T) {
+	t.Setenv(PassphraseEnv, "")
+	dir := t.TempDir()
+	s := NewStore(filepath.Join(dir, "default", "session"), filepath.Join(dir, "session.key"))
+	if _, err := s.Load(); !errors.Is(err, ErrNoSession) {
+		t.Fatalf("Load before Save: err = %v, want ErrNoSession", err)
+	}
+	if err := s.Save(testSession()); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := os.ReadFile(s.Path())
+	if !bytes.HasPrefix(data, magic) || data[len(magic)] != modeKeyFile {
+		t.Errorf("header = %q", data[:len(magic)+1])
+	}
+	if bytes.Contains(data, []byte("secret-cookie-value")) || bytes.Contains(data, []byte("13800000000")) {
+		t.Error("session saved in plaintext")
+	}
+	for _, p := range []string{s.Path(), filepath.Join(dir, "session.key")} {
+		if st, err := os.Stat(p); err != nil || st.Mode().Perm() != 0600 {
+			t.Errorf("%s: mode = %v, err = %v", filepath.Base(p), st.Mode().Perm(), err)
+		}
+	}
+
+	sess, err := s.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sess.Phone != "13800000000" || len(sess.Cookies) != 1 || sess.Cookies[0].Value != "secret-cookie-value" || sess.SavedAt.IsZero() {
+		t.Errorf("loaded %+v", sess)
+	}
+
+	// 换了 key 文件就解不开
+	other := filepath.Join(dir, "other.key")
+	os.WriteFile(other, bytes.Repeat([]byte{0x42}, 32), 0600)
+	if _, err := NewStore(s.Path(), other).Load(); !errors.Is(err, ErrBadPassphrase) {
+		t.Errorf("wrong key: err = %v, want ErrBadPassphrase", err)
+	}
+	os.WriteFile(other, []byte("short"), 0600)
+	if _, err := NewStore(s.Path(), other).Load(); err == nil || !strings.Contains(err.Error(), "32") {
+		t.Errorf("short key: err = %v", err)
+	}
+}
+
+func TestStorePassphrase(t *testing.T) {
+	t.Setenv(PassphraseEnv, "correct horse")
+	path := filepath.Join(t.TempDir(), "session")
+	keyFile := filepath.Join(t.TempDir(), "session.key")
+	if err := NewStore(path, keyFile).Save(testSession()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(keyFile); !os.IsNotExist(err) {
+		t.Error("key file should not be created in passphrase mode")
+	}
+	if sess, err := NewStore(path, keyFile).Load(); err != nil || sess.Nick != "geek" {
+		t.Fatalf("Load = %+v, %v", sess, err)
+	}
+
+	t.Setenv(PassphraseEnv, "wrong")
+	if _, err := NewStore(path, keyFile).Load(); !errors.Is(err, ErrBadPassphrase) {
+		t.Errorf("wrong passphrase: err = %v, want ErrBadPassphrase", err)
+	}
+	t.Setenv(PassphraseEnv, "")
+	if _, err := NewStore(path, keyFile).Load(); err == nil || !strings.Contains(err.Error(), PassphraseEnv) {
+		t.Errorf("missing passphrase: err = %v, should mention %s", err, PassphraseEnv)
+	}
+}
+
+func TestStoreTampered(t *testing.T) {
+	t.Setenv(PassphraseEnv, "")
+	dir := t.TempDir()
+	s := NewStore(filepath.Join(dir, "session"), filepath.Join(dir, "session.key"))
+	if err := s.Save(testSession()); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(s.Path())
+
+	tampered := append([]byte(nil), data...)
+	tampered[len(tampered)-20] ^= 0x01
+	os.WriteFile(s.Path(), tampered, 0600)
+	if _, err := s.Load(); !errors.Is(err, ErrBadPassphrase) {
+		t.Errorf("tampered ciphertext: err = %v, want ErrBadPassphrase", err)
+	}
+
+	os.WriteFile(s.Path(), data[:len(magic)+1+saltSize+4], 0600)
+	if _, err := s.Load(); !errors.Is(err, ErrBadPassphrase) {
+		t.Errorf("truncated: err = %v, want ErrBadPassphrase", err)
+	}
+
+	os.WriteFile(s.Path(), []byte(`{"phone":"13800000000"}`), 0600)
+	if _, err := s.Load(); err == nil || errors.Is(err, ErrNoSession) {
+		t.Errorf("plaintext file: err = %v", err)
+	}
+}
@@ -3,6 +3,9 @@ package utils
 import (
 	"fmt"
 	"math"
+	"strconv"
+	"strings"
+	"unicode"
 )
 
 func Bytes(s uint64) string {
@@ -28,3 +31,30 @@ func humanateBytes(s uint64, base float64, sizes []string) string {
 func logn(n, b float64) float64 {
 	return math.Log(n) / math.Log(b)
 }
+
+// ParseBytes 解析 `512k`, `2MB`, `1.5MiB` 这样的大小, 没有单位时为字节
+func ParseBytes(s string) (uint64, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return !unicode.IsDigit(r) && r != '.'
+	})
+	num, unit := s, ""
+	if i >= 0 {
+		num, unit = s[:i], strings.ToLower(strings.TrimSpace(s[i:]))
+	}
+	f, err := strconv.ParseFloat(num, 64)
+	if err != nil || f < 0 {
+		return 0, fmt.Errorf("无法解析大小 '%s'", s)
+	}
+	var base float64 = 1000
+	if strings.HasSuffix(unit, "ib") {
+		base = 1024
+	}
+	unit = strings.TrimSuffix(strings.TrimSuffix(unit, "ib"), "b")
+	exps := map[string]float64{"": 0, "k": 1, "m": 2, "g": 3, "t": 4}
+	e, ok := exps[unit]
+	if !ok {
+		return 0, fmt.Errorf("无法解析大小 '%s'", s)
+	}
+	return uint64(f * math.Pow(base, e)), nil
+}
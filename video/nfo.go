@@ -0,0 +1,134 @@
+package video
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/duc-cnzj/geekbang2md/api"
+	"github.com/duc-cnzj/geekbang2md/downloader"
+	"github.com/duc-cnzj/geekbang2md/retry"
+	"github.com/duc-cnzj/geekbang2md/waiter"
+)
+
+// Jellyfin/Plex/Kodi 兼容的 nfo 元数据, 课程目录当成剧集, 每一讲是其中的一集
+
+type nfoActor struct {
+	Name string `xml:"name"`
+	Role string `xml:"role"`
+}
+
+type tvShowNfo struct {
+	XMLName xml.Name   `xml:"tvshow"`
+	Title   string     `xml:"title"`
+	Plot    string     `xml:"plot,omitempty"`
+	Studio  string     `xml:"studio"`
+	Actors  []nfoActor `xml:"actor"`
+	Tags    []string   `xml:"tag"`
+	Thumb   string     `xml:"thumb,omitempty"`
+	Fanart  string     `xml:"fanart>thumb,omitempty"`
+}
+
+type episodeNfo struct {
+	XMLName   xml.Name `xml:"episodedetails"`
+	Title     string   `xml:"title"`
+	ShowTitle string   `xml:"showtitle"`
+	Season    int      `xml:"season"`
+	Episode   int      `xml:"episode"`
+	Plot      string   `xml:"plot,omitempty"`
+	Runtime   int      `xml:"runtime,omitempty"`
+	Aired     string   `xml:"aired,omitempty"`
+	Thumb     string   `xml:"thumb,omitempty"`
+}
+
+func writeNfo(p string, v interface{}) error {
+	marshal, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p, append([]byte(xml.Header), marshal...), 0644)
+}
+
+// writeShowNfo 生成 tvshow.nfo 以及 poster/fanart 图片
+func (v *Video) writeShowNfo() {
+	show := &tvShowNfo{
+		Title:  v.title,
+		Plot:   v.intro,
+		Studio: "极客时间",
+		Actors: []nfoActor{{Name: v.author, Role: "讲师"}},
+		Tags:   v.keywords,
+	}
+	if p := v.downloadArtwork(v.poster, "poster"); p != "" {
+		show.Thumb = p
+	}
+	if p := v.downloadArtwork(v.fanart, "fanart"); p != "" {
+		show.Fanart = p
+	}
+	if err := writeNfo(v.DownloadPath("tvshow.nfo"), show); err != nil {
+		log.Printf("[NFO]: '%s' 写入 tvshow.nfo 出错: %v\n", v.title, err)
+	}
+}
+
+// writeEpisodeNfo 生成和视频同名的 `<title>.nfo` 以及 `<title>-thumb.jpg`
+func (v *Video) writeEpisodeNfo(title string, episode int, article *api.ArticleResponse) {
+	ep := &episodeNfo{
+		Title:     article.Data.ArticleTitle,
+		ShowTitle: v.title,
+		Season:    1,
+		Episode:   episode,
+		Plot:      article.Data.ArticleSummary,
+		Runtime:   runtimeMinutes(article.Data.VideoTime),
+		Thumb:     v.downloadArtwork(article.Data.VideoCover, title+"-thumb"),
+	}
+	if article.Data.ArticleCtime > 0 {
+		ep.Aired = time.Unix(int64(article.Data.ArticleCtime), 0).Format("2006-01-02")
+	}
+	if err := writeNfo(v.DownloadPath(title+".nfo"), ep); err != nil {
+		log.Printf("[NFO]: '%s' 写入出错: %v\n", title, err)
+	}
+}
+
+// downloadArtwork 下载图片到课程目录, 返回相对课程目录的文件名
+func (v *Video) downloadArtwork(u, name string) string {
+	if u == "" {
+		return ""
+	}
+	ext := ".jpg"
+	if parse, err := url.Parse(u); err == nil && path.Ext(parse.Path) != "" {
+		ext = path.Ext(parse.Path)
+	}
+	p := v.DownloadPath(name + ext)
+	limiter := waiter.Default.ForURL(u, waiter.ClassAsset)
+	limiter.Wait(context.TODO())
+	defer limiter.Release()
+	if err := retry.Do(u, func() error {
+		_, err := downloader.Default.Download(u, p)
+		return err
+	}); err != nil {
+		if !errors.Is(err, api.ErrOffline) {
+			log.Printf("[NFO]: 下载图片 '%s' 出错: %v\n", u, err)
+		}
+		return ""
+	}
+	return name + ext
+}
+
+// runtimeMinutes 把 `01:02:03`/`02:03` 或秒数转换成分钟
+func runtimeMinutes(t string) int {
+	var seconds int
+	for _, s := range strings.Split(t, ":") {
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			return 0
+		}
+		seconds = seconds*60 + n
+	}
+	return (seconds + 59) / 60
+}
@@ -0,0 +1,152 @@
+package video
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/duc-cnzj/geekbang2md/api"
+)
+
+type cue struct {
+	start, end time.Duration
+	text       string
+}
+
+var cueTimeRegexp = regexp.MustCompile(`^(?:(\d+):)?(\d{1,2}):(\d{1,2})[,.](\d{1,3})$`)
+
+// parseSubtitle 解析 srt/vtt 格式的字幕, 两者的区别只在头部和时间戳的分隔符
+func parseSubtitle(data []byte) ([]*cue, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	var cues []*cue
+	for _, block := range strings.Split(text, "\n\n") {
+		lines := strings.Split(strings.Trim(block, "\n"), "\n")
+		for i, line := range lines {
+			if !strings.Contains(line, "-->") {
+				continue
+			}
+			from, to, _ := strings.Cut(line, "-->")
+			start, err := parseCueTime(from)
+			if err != nil {
+				return nil, err
+			}
+			// vtt 的时间后面可能跟着 position/align 等设置
+			fields := strings.Fields(to)
+			if len(fields) == 0 {
+				return nil, fmt.Errorf("subtitle: invalid cue '%s'", line)
+			}
+			end, err := parseCueTime(fields[0])
+			if err != nil {
+				return nil, err
+			}
+			cues = append(cues, &cue{start: start, end: end, text: strings.Join(lines[i+1:], "\n")})
+			break
+		}
+	}
+	if len(cues) == 0 {
+		return nil, errors.New("subtitle: no cues found")
+	}
+	return cues, nil
+}
+
+func parseCueTime(s string) (time.Duration, error) {
+	matches := cueTimeRegexp.FindStringSubmatch(strings.TrimSpace(s))
+	if matches == nil {
+		return 0, fmt.Errorf("subtitle: invalid timestamp '%s'", s)
+	}
+	h, _ := strconv.Atoi(matches[1])
+	m, _ := strconv.Atoi(matches[2])
+	sec, _ := strconv.Atoi(matches[3])
+	ms, _ := strconv.Atoi((matches[4] + "00")[:3])
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(sec)*time.Second + time.Duration(ms)*time.Millisecond, nil
+}
+
+func formatCueTime(d time.Duration, sep string) string {
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60, sep, d.Milliseconds()%1000)
+}
+
+func writeSRT(path string, cues []*cue) error {
+	bf := bytes.Buffer{}
+	for i, c := range cues {
+		fmt.Fprintf(&bf, "%d\n%s --> %s\n%s\n\n", i+1, formatCueTime(c.start, ","), formatCueTime(c.end, ","), c.text)
+	}
+	return os.WriteFile(path, bf.Bytes(), 0644)
+}
+
+func writeVTT(path string, cues []*cue) error {
+	bf := bytes.NewBufferString("WEBVTT\n\n")
+	for _, c := range cues {
+		fmt.Fprintf(bf, "%s --> %s\n%s\n\n", formatCueTime(c.start, "."), formatCueTime(c.end, "."), c.text)
+	}
+	return os.WriteFile(path, bf.Bytes(), 0644)
+}
+
+// writeSubtitles 把视频的字幕转换成 `<title>.<lang>.srt` 和 `<title>.<lang>.vtt`, 放在视频旁边播放器才能自动识别
+func (v *Video) writeSubtitles(title string, subtitles []interface{}) {
+	seen := map[string]int{}
+	for _, item := range subtitles {
+		marshal, _ := json.Marshal(item)
+		var sub api.Subtitle
+		if err := json.Unmarshal(marshal, &sub); err != nil {
+			log.Printf("[Subtitle]: '%s' 字幕格式无法识别: %s\n", title, string(marshal))
+			continue
+		}
+		lang := sub.Lang
+		if lang == "" {
+			lang = sub.Language
+		}
+		if lang == "" {
+			lang = "zh"
+		}
+		seen[lang]++
+		if seen[lang] > 1 {
+			lang = fmt.Sprintf("%s%d", lang, seen[lang])
+		}
+		srt, vtt := v.DownloadPath(title+"."+lang+".srt"), v.DownloadPath(title+"."+lang+".vtt")
+		if fileExists(srt) && fileExists(vtt) {
+			continue
+		}
+		data := []byte(sub.Content)
+		if len(data) == 0 && sub.URL != "" {
+			if api.Offline() {
+				continue
+			}
+			get, err := api.NewBackoffClient(0).Get(sub.URL)
+			if err != nil {
+				log.Printf("[Subtitle]: '%s' 下载字幕出错: %v\n", title, err)
+				continue
+			}
+			data, err = io.ReadAll(get.Body)
+			get.Body.Close()
+			if err != nil {
+				log.Printf("[Subtitle]: '%s' 下载字幕出错: %v\n", title, err)
+				continue
+			}
+		}
+		cues, err := parseSubtitle(data)
+		if err != nil {
+			log.Printf("[Subtitle]: '%s' %v\n", title, err)
+			continue
+		}
+		if err := writeSRT(srt, cues); err != nil {
+			log.Println(err)
+		}
+		if err := writeVTT(vtt, cues); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+func fileExists(path string) bool {
+	st, err := os.Stat(path)
+	return err == nil && st.Size() > 0
+}
@@ -0,0 +1,51 @@
+package video
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriteSubtitles(t *testing.T) {
+	v := &Video{baseDir: t.TempDir()}
+	srt := "\xef\xbb\xbf1\r\n00:00:01,500 --> 00:00:03,000\r\n大家好\r\n\r\n2\r\n1:02:03,04 --> 1:02:05,000\r\n第一行\r\n第二行\r\n"
+	vtt := "WEBVTT\n\n00:01.500 --> 00:03.000 align:start position:10%\n大家好\n\nintro\n01:02:03.040 --> 01:02:05.000\n第一行\n第二行\n"
+	v.writeSubtitles("01 | 开篇词", []interface{}{
+		map[string]interface{}{"lang": "zh", "content": srt},
+		map[string]interface{}{"language": "zh", "content": vtt},
+		map[string]interface{}{"content": "broken"},
+		"not an object",
+	})
+
+	wantSRT := "1\n00:00:01,500 --> 00:00:03,000\n大家好\n\n2\n01:02:03,040 --> 01:02:05,000\n第一行\n第二行\n\n"
+	wantVTT := "WEBVTT\n\n00:00:01.500 --> 00:00:03.000\n大家好\n\n01:02:03.040 --> 01:02:05.000\n第一行\n第二行\n\n"
+	// 同一种语言的第二份字幕加上序号, 不会覆盖第一份
+	for _, lang := range []string{"zh", "zh2"} {
+		if got, _ := os.ReadFile(v.DownloadPath("01 | 开篇词." + lang + ".srt")); string(got) != wantSRT {
+			t.Errorf("%s.srt = %q", lang, got)
+		}
+		if got, _ := os.ReadFile(v.DownloadPath("01 | 开篇词." + lang + ".vtt")); string(got) != wantVTT {
+			t.Errorf("%s.vtt = %q", lang, got)
+		}
+	}
+	if files, _ := filepath.Glob(filepath.Join(v.baseDir, "*")); len(files) != 4 {
+		t.Errorf("files = %v, broken subtitles should be skipped", files)
+	}
+}
+
+func TestParseCueTime(t *testing.T) {
+	d, err := parseCueTime(" 1:02:03,04 ")
+	if want := time.Hour + 2*time.Minute + 3*time.Second + 40*time.Millisecond; err != nil || d != want {
+		t.Errorf("parseCueTime = %s, %v, want %s", d, err, want)
+	}
+	if got := formatCueTime(d, "."); got != "01:02:03.040" {
+		t.Errorf("formatCueTime = %s", got)
+	}
+	if _, err := parseCueTime("00:00:xx,000"); err == nil {
+		t.Error("want error for invalid timestamp")
+	}
+	if _, err := parseSubtitle([]byte("WEBVTT\n\n")); err == nil {
+		t.Error("want error for subtitle without cues")
+	}
+}
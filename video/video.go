@@ -1,32 +1,26 @@
 package video
 
 import (
-	"bufio"
-	"context"
-	"crypto/aes"
-	"crypto/cipher"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
+	"html"
 	"io/fs"
 	"log"
 	"net/url"
 	"os"
 	"path/filepath"
-	"regexp"
-	"sort"
 	"strconv"
 	"strings"
 	"sync"
-	"time"
 
 	"github.com/duc-cnzj/geekbang2md/api"
-	"github.com/duc-cnzj/geekbang2md/bar"
-	"github.com/duc-cnzj/geekbang2md/constant"
+	"github.com/duc-cnzj/geekbang2md/cache"
+	"github.com/duc-cnzj/geekbang2md/hls"
+	"github.com/duc-cnzj/geekbang2md/image"
+	"github.com/duc-cnzj/geekbang2md/markdown"
 	"github.com/duc-cnzj/geekbang2md/notice"
 	"github.com/duc-cnzj/geekbang2md/utils"
-	"github.com/duc-cnzj/geekbang2md/waiter"
 )
 
 type Video struct {
@@ -39,6 +33,10 @@ type Video struct {
 	author   string
 	count    int
 	keywords []string
+
+	intro, poster, fanart string
+
+	mdWriter *markdown.MDWriter
 }
 
 var baseDir string
@@ -47,9 +45,7 @@ func Init(d string) {
 	baseDir = filepath.Join(d, "videos")
 }
 
-var uregex = regexp.MustCompile(`URI="(.*?)"`)
-
-func NewVideo(title string, id int, author string, count int, keywords []string) *Video {
+func NewVideo(title string, id int, author string, count int, keywords []string, intro, poster, fanart string) *Video {
 	d := filepath.Join(baseDir, utils.FilterCharacters(title))
 	os.MkdirAll(d, 0755)
 	return &Video{
@@ -59,30 +55,16 @@ func NewVideo(title string, id int, author string, count int, keywords []string)
 		author:   author,
 		count:    count,
 		keywords: keywords,
+		intro:    intro,
+		poster:   poster,
+		fanart:   fanart,
+		mdWriter: markdown.NewMDWriter(d, title, image.NewManager(filepath.Join(d, "images"))),
 	}
 }
 
-var tsFileRegexp = regexp.MustCompile(`\w+.*?-(\d+)\.ts`)
-
-type Seg struct {
-	id      int
-	path    string
-	fullUrl string
-}
+type Seg = hls.Seg
 
-type Segs []*Seg
-
-func (s Segs) Len() int {
-	return len(s)
-}
-
-func (s Segs) Less(i, j int) bool {
-	return s[i].id < s[j].id
-}
-
-func (s Segs) Swap(i, j int) {
-	s[i], s[j] = s[j], s[i]
-}
+type Segs = hls.Segs
 
 func (v *Video) DownloadPath(name string) string {
 	return filepath.Join(v.baseDir, utils.FilterCharacters(name))
@@ -93,21 +75,19 @@ func (v *Video) SegDownloadPath(name string) string {
 }
 
 func (v *Video) DeleteSegs(segs ...*Seg) error {
-	for _, seg := range segs {
-		if err := os.Remove(seg.path); err != nil {
-			log.Printf("remove '%s', err: %v", seg.path, err)
-		}
-	}
-	return nil
+	return hls.DeleteSegs(segs...)
 }
 
 func (v *Video) Download() error {
 	utils.WriteReadmeMD(v.baseDir, v.title, v.author, v.count, v.keywords)
+	v.writeShowNfo()
 	articles, err := api.Articles(v.cid)
 	if err != nil {
 		return err
 	}
 	currentCount := len(articles.Data.List)
+	// missing/corrupt 离线模式下没有缓存以及缓存已损坏的课时
+	var missing, corrupt int
 	for i := range articles.Data.List {
 		func(num int) {
 			s := articles.Data.List[i]
@@ -117,31 +97,31 @@ func (v *Video) Download() error {
 			}
 			title := utils.GetTitle(s.ArticleTitle, num, pad)
 
-			for i := 0; i < 3; i++ {
-				article, err := api.Article(strconv.Itoa(s.ID))
-				if err != nil {
-					log.Printf("[Download]: article: %s err: %v \n", s.ArticleTitle, err)
-					return
-				}
-				marshal, _ := json.Marshal(article.Data.HlsVideos)
-				var vi api.Video
-				json.Unmarshal(marshal, &vi)
-				if vi.Hd.URL == "" {
-					api.DeleteArticleCache(strconv.Itoa(s.ID))
-					log.Printf("[ERROR]: 视频: '%s', 下载地址为空！ \n", s.ArticleTitle)
-					return
-				}
-				err = download(v.DownloadPath(title+".ts"), vi.Hd.URL, v, title, strconv.Itoa(s.ID))
-				if !errors.Is(err, ErrorRetry) {
-					break
-				}
-				time.Sleep(500 * time.Millisecond)
+			err := v.downloadLesson(title, num, pad, s)
+			if errors.Is(err, api.ErrOffline) {
+				missing++
+				log.Printf("[OFFLINE]: %s 没有缓存\n", title)
+				return
+			}
+			if api.Offline() && errors.Is(err, cache.ErrCorrupt) {
+				corrupt++
+				log.Printf("[CORRUPT]: %s %v\n", title, err)
+				return
 			}
 			if err != nil {
 				log.Printf("\n下载出错: %v\n", err)
 			}
 		}(i)
 	}
+	if api.Offline() {
+		if missing > 0 {
+			notice.CourseWarning(v.title, v.author, fmt.Sprintf("离线模式下有 %d 课时没有缓存", missing), "去掉 -offline 重新运行下载这些课时", "视频")
+		}
+		if corrupt > 0 {
+			notice.CourseWarning(v.title, v.author, fmt.Sprintf("离线模式下有 %d 课时的缓存已损坏", corrupt), "使用 cache verify --repair 隔离后, 去掉 -offline 重新下载", "视频")
+		}
+		return nil
+	}
 	var count int
 	var hasSegs bool
 	filepath.WalkDir(v.baseDir, func(path string, d fs.DirEntry, err error) error {
@@ -164,154 +144,63 @@ func (v *Video) Download() error {
 	if hasSegs || count < currentCount {
 		notice.CourseWarning(v.title, v.author, "课程未完全下载完成", "多次重试直到该警告消失", "视频")
 	}
-	if v.count > currentCount {
-		api.DeleteArticlesCache(v.cid)
-	}
 	return nil
 }
 
-var ErrorRetry = errors.New("retry")
-
-func download(downloadPath string, hdUrl string, v *Video, title string, id string) error {
-	var err error
-	stat, err := os.Stat(downloadPath)
-	if err == nil && stat.Size() > 0 {
-		return nil
-	}
-
-	parse, err := url.Parse(hdUrl)
-	if err != nil {
-		return err
-	}
-
-	get, err := api.NewBackoffClient(3).Get(hdUrl)
+// downloadLesson 生成课程文稿后下载视频, api 请求和每个 segment 都有各自的重试, 这里不再整体重试
+func (v *Video) downloadLesson(title string, num, pad int, s *api.ArticlesResponseItem) error {
+	article, err := api.Article(strconv.Itoa(s.ID))
 	if err != nil {
-		return err
+		return fmt.Errorf("article: %s err: %w", s.ArticleTitle, err)
 	}
-	defer get.Body.Close()
-	m3u8, err := io.ReadAll(get.Body)
-	if err != nil {
-		return err
+	v.writeLesson(title, num+1, utils.GetArticleNumber(num, pad), &article)
+	if api.Offline() {
+		return nil
 	}
-
-	baseUrl := fmt.Sprintf("https://%s/%s/", parse.Host, strings.Split(parse.Path, "/")[1])
-	os.MkdirAll(v.DownloadPath("segs"), 0755)
-	var items Segs
-	stringSubmatch := tsFileRegexp.FindAllStringSubmatch(string(m3u8), -1)
-	for _, s := range stringSubmatch {
-		id, _ := strconv.Atoi(s[1])
-		items = append(items, &Seg{
-			id:      id,
-			path:    v.SegDownloadPath(s[0]),
-			fullUrl: baseUrl + s[0],
-		})
+	marshal, _ := json.Marshal(article.Data.HlsVideos)
+	var vi api.Video
+	json.Unmarshal(marshal, &vi)
+	if vi.Hd.URL == "" {
+		api.DeleteArticleCache(strconv.Itoa(s.ID))
+		return fmt.Errorf("视频: '%s', 下载地址为空", s.ArticleTitle)
 	}
+	return download(v.DownloadPath(title+".ts"), vi.Hd.URL, v, title, strconv.Itoa(s.ID))
+}
 
-	wg := sync.WaitGroup{}
-	sigWaiter := waiter.NewSigWaiter(constant.VideoDownloadParallelNum)
-	var b bar.Interface = bar.NewBar(title, len(items))
-	for i := range items {
-		wg.Add(1)
-		sigWaiter.Wait(context.TODO())
-		go func(s *Seg) {
-			defer wg.Done()
-			defer b.Add()
-			defer sigWaiter.Release()
-			st, err := os.Stat(s.path)
-			if err == nil && st.Size() > 0 {
-				//log.Printf("%s exists", s.path)
-				return
-			}
-			get, err := api.NewBackoffClient(3).Get(s.fullUrl)
-			if err != nil {
-				return
-			}
-			defer get.Body.Close()
-			if get.ContentLength > 0 {
-				file, err := os.OpenFile(s.path, os.O_TRUNC|os.O_RDWR|os.O_CREATE, 0644)
-				if err != nil {
-					return
-				}
-				defer file.Close()
-				io.Copy(file, bufio.NewReaderSize(get.Body, 1024*1024*10))
-			}
-		}(items[i])
-	}
+// writeLesson 在视频旁边生成同名的课程文稿、字幕和 nfo 文件
+func (v *Video) writeLesson(title string, episode int, articleNumber string, article *api.ArticleResponse) {
+	v.writeSubtitles(title, article.Data.Subtitles)
+	v.writeEpisodeNfo(title, episode, article)
 
-	wg.Wait()
-	sort.Sort(items)
-	submatch := uregex.FindStringSubmatch(string(m3u8))
-	key, err := api.VideoKey(submatch[1], id)
-	if err != nil {
-		return err
+	if _, _, exists := v.mdWriter.FileExists(title); exists && !api.Offline() {
+		return
 	}
-	if len(key) == 0 {
-		api.DeleteArticleCache(id)
-		return fmt.Errorf("%w, 当前获取不到解码的 key 值", ErrorRetry)
+	var content string
+	if article.Data.ArticleSummary != "" {
+		content = fmt.Sprintf("<blockquote><p>%s</p></blockquote>", html.EscapeString(article.Data.ArticleSummary))
 	}
-
-	f, err := os.OpenFile(downloadPath, os.O_TRUNC|os.O_RDWR|os.O_CREATE, 0644)
-	if err != nil {
-		return err
+	content += article.Data.ArticleContent
+	if strings.TrimSpace(content) == "" {
+		return
 	}
-	defer f.Close()
-	for _, item := range items {
-		file, err := os.ReadFile(item.path)
-		if err != nil {
-			return err
-		}
-		aes128, err := decryptAES128(file, key, make([]byte, 16))
-		if err != nil {
-			v.DeleteSegs(items...)
-			f.Close()
-			os.Remove(downloadPath)
-			return fmt.Errorf("[%w]: reason: '%s' path: '%s'", ErrorRetry, err.Error(), item.path)
-		}
-		for j := 0; j < len(aes128); j++ {
-			if aes128[j] == syncByte {
-				aes128 = aes128[j:]
-				break
-			}
-		}
-
-		if _, err := f.Write(aes128); err != nil {
-			return err
-		}
+	if _, err := v.mdWriter.WriteFile(articleNumber, "", "", "", "", title, content); err != nil {
+		log.Printf("[Download]: 视频文稿 '%s' 写入出错: %v\n", title, err)
 	}
-	v.DeleteSegs(items...)
-	info, _ := f.Stat()
-	log.Printf("\n[SUCCESS]: 下载成功 '%s', 大小: '%s'", title, utils.Bytes(uint64(info.Size())))
-	return nil
 }
 
-const (
-	syncByte = uint8(71) //0x47
-)
+var ErrorRetry = hls.ErrorRetry
 
-func decryptAES128(crypted, key, iv []byte) (origData []byte, err error) {
-	defer func() {
-		e := recover()
-		switch edata := e.(type) {
-		case string:
-			err = fmt.Errorf("%s, len key: %d", edata, len(key))
-		case error:
-			err = fmt.Errorf("%w: key len: %d", edata, len(key))
-		}
-	}()
-	block, err := aes.NewCipher(key)
+func download(downloadPath string, hdUrl string, v *Video, title string, id string) error {
+	parse, err := url.Parse(hdUrl)
 	if err != nil {
-		return nil, fmt.Errorf("%w: key len: %d", err, len(key))
+		return err
 	}
-	blockSize := block.BlockSize()
-	blockMode := cipher.NewCBCDecrypter(block, iv[:blockSize])
-	origData = make([]byte, len(crypted))
-	blockMode.CryptBlocks(origData, crypted)
-	origData = pkcs5UnPadding(origData)
-	return
-}
 
-func pkcs5UnPadding(origData []byte) []byte {
-	length := len(origData)
-	unPadding := int(origData[length-1])
-	return origData[:(length - unPadding)]
+	return hls.Download(downloadPath, &hls.HLS{
+		URL:     hdUrl,
+		BaseURL: fmt.Sprintf("https://%s/%s/", parse.Host, strings.Split(parse.Path, "/")[1]),
+		SegDir:  v.DownloadPath("segs"),
+		Title:   title,
+		ID:      id,
+	})
 }
@@ -0,0 +1,143 @@
+package waiter
+
+import (
+	"encoding/json"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Feedback 限流器根据请求结果调整速率
+type Feedback interface {
+	// Success 请求成功
+	Success()
+	// Throttled 被服务端限流, 返回需要暂停的时间
+	Throttled() time.Duration
+}
+
+const (
+	// adaptiveIncreaseAfter 连续成功多少次后提高一次速率
+	adaptiveIncreaseAfter = 20
+	adaptiveBaseBackoff   = 20 * time.Second
+	adaptiveMaxBackoff    = 5 * time.Minute
+)
+
+// Adaptive AIMD 限流器: 被限流时速率减半并指数退避, 持续成功后缓慢提高速率,
+// 学习到的速率保存在 statePath, 下次运行继续使用
+type Adaptive struct {
+	*Limiter
+
+	mu          sync.Mutex
+	min, max    rate.Limit
+	step        rate.Limit
+	successes   int
+	failures    int
+	pausedUntil time.Time
+	statePath   string
+	now         func() time.Time
+}
+
+type adaptiveState struct {
+	Limit   float64   `json:"limit"`
+	SavedAt time.Time `json:"saved_at"`
+}
+
+// NewAdaptive l.Rate 为初始速率, 必须大于 0, 速率在 [r/10, r*5] 之间调整, 并发数固定为 l.Concurrency,
+// statePath 为空时不保存。不限速(Rate 为 0)时没有调整的基准, 调用方不应该使用 Adaptive
+func NewAdaptive(l Limit, statePath string) *Adaptive {
+	r := l.Rate
+	a := &Adaptive{
+		Limiter:   NewLimiter(l),
+		min:       r / 10,
+		max:       r * 5,
+		step:      r / 10,
+		statePath: statePath,
+		now:       time.Now,
+	}
+	if statePath != "" {
+		if data, err := os.ReadFile(statePath); err == nil {
+			var state adaptiveState
+			if json.Unmarshal(data, &state) == nil && state.Limit > 0 {
+				a.rt.SetLimit(a.clamp(rate.Limit(state.Limit)))
+			}
+		}
+	}
+	log.Printf("请求速率: %s\n", formatLimit(a.Limit()))
+	return a
+}
+
+func (a *Adaptive) Limit() rate.Limit {
+	return a.rt.Limit()
+}
+
+func (a *Adaptive) Success() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.failures = 0
+	a.successes++
+	if a.successes < adaptiveIncreaseAfter {
+		return
+	}
+	a.successes = 0
+	if l := a.rt.Limit(); l < a.max {
+		a.setLimit(l + a.step)
+	}
+}
+
+// Throttled 暂停期间收到的限流响应属于同一次限流, 不会重复降速
+func (a *Adaptive) Throttled() time.Duration {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := a.now()
+	if now.Before(a.pausedUntil) {
+		return a.pausedUntil.Sub(now)
+	}
+	a.successes = 0
+	a.failures++
+	a.setLimit(a.rt.Limit() / 2)
+
+	d := adaptiveBaseBackoff << (a.failures - 1)
+	if d > adaptiveMaxBackoff || d <= 0 {
+		d = adaptiveMaxBackoff
+	}
+	// 一半固定一半随机, 避免多个进程同时恢复请求
+	d = d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+	a.pausedUntil = now.Add(d)
+	return d
+}
+
+func (a *Adaptive) clamp(l rate.Limit) rate.Limit {
+	if l < a.min {
+		return a.min
+	}
+	if l > a.max {
+		return a.max
+	}
+	return l
+}
+
+func (a *Adaptive) setLimit(l rate.Limit) {
+	l = a.clamp(l)
+	if l == a.rt.Limit() {
+		return
+	}
+	a.rt.SetLimit(l)
+	log.Printf("请求速率调整为: %s\n", formatLimit(l))
+	if a.statePath == "" {
+		return
+	}
+	marshal, _ := json.Marshal(adaptiveState{Limit: float64(l), SavedAt: a.now()})
+	os.MkdirAll(filepath.Dir(a.statePath), 0700)
+	if err := os.WriteFile(a.statePath, marshal, 0644); err != nil {
+		log.Println("保存请求速率失败:", err)
+	}
+}
+
+func formatLimit(l rate.Limit) string {
+	return time.Duration(float64(time.Second)/float64(l)).Round(10*time.Millisecond).String() + "/次"
+}
@@ -0,0 +1,110 @@
+package waiter
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) Now() time.Time          { return c.t }
+func (c *fakeClock) Advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestAdaptive(r rate.Limit, statePath string) (*Adaptive, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)}
+	a := NewAdaptive(Limit{Rate: r, Burst: 1}, statePath)
+	a.now = clock.Now
+	return a, clock
+}
+
+func TestAdaptiveIncrease(t *testing.T) {
+	a, _ := newTestAdaptive(1, "")
+	for i := 1; i < adaptiveIncreaseAfter; i++ {
+		a.Success()
+	}
+	if a.Limit() != 1 {
+		t.Fatalf("limit = %v after %d successes, want unchanged", a.Limit(), adaptiveIncreaseAfter-1)
+	}
+	a.Success()
+	if a.Limit() != 1.1 {
+		t.Fatalf("limit = %v, want 1 + 0.1", a.Limit())
+	}
+	// 上限是初始速率的 5 倍
+	for i := 0; i < adaptiveIncreaseAfter*100; i++ {
+		a.Success()
+	}
+	if a.Limit() != 5 {
+		t.Errorf("limit = %v, want ceiling 5", a.Limit())
+	}
+}
+
+func TestAdaptiveThrottled(t *testing.T) {
+	a, clock := newTestAdaptive(1, "")
+	d := a.Throttled()
+	if a.Limit() != 0.5 {
+		t.Fatalf("limit = %v, want halved to 0.5", a.Limit())
+	}
+	if d < adaptiveBaseBackoff/2 || d > adaptiveBaseBackoff {
+		t.Errorf("backoff = %s, want between %s and %s", d, adaptiveBaseBackoff/2, adaptiveBaseBackoff)
+	}
+
+	// 暂停期间的限流响应属于同一次限流
+	clock.Advance(d / 2)
+	if remain := a.Throttled(); remain != d-d/2 || a.Limit() != 0.5 {
+		t.Errorf("during pause: remain = %s, limit = %v", remain, a.Limit())
+	}
+
+	// 连续限流时退避时间翻倍
+	clock.Advance(d)
+	if d2 := a.Throttled(); d2 < adaptiveBaseBackoff || d2 > 2*adaptiveBaseBackoff || a.Limit() != 0.25 {
+		t.Errorf("second throttle: backoff = %s, limit = %v", d2, a.Limit())
+	}
+
+	// 下限是初始速率的 1/10, 退避时间不超过 adaptiveMaxBackoff
+	for i := 0; i < 20; i++ {
+		clock.Advance(adaptiveMaxBackoff)
+		if d := a.Throttled(); d > adaptiveMaxBackoff {
+			t.Fatalf("backoff = %s, want at most %s", d, adaptiveMaxBackoff)
+		}
+	}
+	if a.Limit() != 0.1 {
+		t.Errorf("limit = %v, want floor 0.1", a.Limit())
+	}
+
+	// 成功会重置连续失败的次数
+	a.Success()
+	clock.Advance(adaptiveMaxBackoff)
+	if d := a.Throttled(); d > adaptiveBaseBackoff {
+		t.Errorf("backoff after success = %s, want reset", d)
+	}
+}
+
+func TestAdaptiveState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profile", "ratelimit.json")
+	a, _ := newTestAdaptive(1, path)
+	a.Throttled()
+
+	var state adaptiveState
+	data, err := os.ReadFile(path)
+	if err != nil || json.Unmarshal(data, &state) != nil || state.Limit != 0.5 || !state.SavedAt.Equal(a.now()) {
+		t.Fatalf("state = %s, %v", data, err)
+	}
+	if b, _ := newTestAdaptive(1, path); b.Limit() != 0.5 {
+		t.Errorf("restored limit = %v, want 0.5", b.Limit())
+	}
+
+	// 保存的速率超出新的范围时按范围截断
+	os.WriteFile(path, []byte(`{"limit": 100}`), 0644)
+	if b, _ := newTestAdaptive(1, path); b.Limit() != 5 {
+		t.Errorf("restored limit = %v, want clamped to 5", b.Limit())
+	}
+	os.WriteFile(path, []byte(`broken`), 0644)
+	if b, _ := newTestAdaptive(2, path); b.Limit() != 2 {
+		t.Errorf("limit = %v, broken state should be ignored", b.Limit())
+	}
+}
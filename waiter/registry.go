@@ -0,0 +1,198 @@
+package waiter
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/sync/semaphore"
+	"golang.org/x/time/rate"
+
+	"github.com/duc-cnzj/geekbang2md/constant"
+)
+
+// Class 请求类型, 不同类型的请求使用不同的限流配置
+type Class string
+
+const (
+	// ClassAPI 接口请求, 例如课程、文章列表
+	ClassAPI Class = "api"
+	// ClassKey 视频解密 key
+	ClassKey Class = "key"
+	// ClassAsset 图片、mp3、封面等静态资源
+	ClassAsset Class = "asset"
+	// ClassSegment 视频 segment
+	ClassSegment Class = "segment"
+)
+
+// Limit Rate 为 0 时不限速, Concurrency 为 0 时不限制并发
+type Limit struct {
+	Rate        rate.Limit
+	Burst       int
+	Concurrency int64
+}
+
+// DefaultLimits 没有单独配置 host 时每个 host 使用的默认配置
+var DefaultLimits = map[Class]Limit{
+	ClassAPI:     {Rate: constant.RequestLimit, Burst: constant.BucketSize},
+	ClassKey:     {Rate: 2, Burst: 5, Concurrency: 5},
+	ClassAsset:   {Concurrency: 30},
+	ClassSegment: {Concurrency: 20},
+}
+
+// Default 全局的限流器, 图片、音频、视频的下载都使用它
+var Default = NewRegistry(DefaultLimits)
+
+// Registry 按 host 和请求类型区分的限流器, 同一个 host 同一类请求共用一个限流器
+type Registry struct {
+	mu       sync.Mutex
+	limits   map[string]Limit
+	limiters map[string]Interface
+}
+
+func NewRegistry(defaults map[Class]Limit) *Registry {
+	r := &Registry{limits: map[string]Limit{}, limiters: map[string]Interface{}}
+	for class, l := range defaults {
+		r.limits[registryKey("", class)] = l
+	}
+	return r
+}
+
+func registryKey(host string, class Class) string {
+	return strings.ToLower(host) + "|" + string(class)
+}
+
+// Configure host 为空时修改该类请求的默认配置, 受影响的限流器会被丢弃, 之后 Get 时按新配置重新创建,
+// 已经拿到的旧实例不受影响
+func (r *Registry) Configure(host string, class Class, l Limit) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := registryKey(host, class)
+	r.limits[key] = l
+	for k := range r.limiters {
+		if !strings.HasSuffix(k, "|"+string(class)) {
+			continue
+		}
+		// 修改默认配置时, 单独配置过的 host 不受影响
+		if _, own := r.limits[k]; k == key || (host == "" && !own) {
+			delete(r.limiters, k)
+		}
+	}
+}
+
+// Set 使用自定义的限流器, 比如 Adaptive
+func (r *Registry) Set(host string, class Class, limiter Interface) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.limiters[registryKey(host, class)] = limiter
+}
+
+// Limit host 没有单独配置时返回该类请求的默认配置
+func (r *Registry) Limit(host string, class Class) Limit {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if l, ok := r.limits[registryKey(host, class)]; ok {
+		return l
+	}
+	return r.limits[registryKey("", class)]
+}
+
+func (r *Registry) Get(host string, class Class) Interface {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := registryKey(host, class)
+	if l, ok := r.limiters[key]; ok {
+		return l
+	}
+	l, ok := r.limits[key]
+	if !ok {
+		l = r.limits[registryKey("", class)]
+	}
+	limiter := NewLimiter(l)
+	r.limiters[key] = limiter
+	return limiter
+}
+
+// ForURL 按 u 的 host 获取限流器, u 解析失败时使用空 host
+func (r *Registry) ForURL(u string, class Class) Interface {
+	var host string
+	if parse, err := url.Parse(u); err == nil {
+		host = parse.Hostname()
+	}
+	return r.Get(host, class)
+}
+
+// Parse 解析 -limits 参数, 多个配置用 ';' 分隔, 格式: class[@host]=rate,burst,concurrency
+// 例如: "segment=0,0,10;asset@static001.geekbang.org=5,10,20", rate 为每秒请求数
+func (r *Registry) Parse(spec string) error {
+	for _, item := range strings.Split(spec, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return fmt.Errorf("限流配置 '%s' 格式不正确, 应该为 class[@host]=rate,burst,concurrency", item)
+		}
+		classStr, host, _ := strings.Cut(name, "@")
+		class := Class(strings.TrimSpace(classStr))
+		if _, ok := DefaultLimits[class]; !ok {
+			return fmt.Errorf("未知的请求类型 '%s', 可选: api, key, asset, segment", class)
+		}
+		fields := strings.Split(value, ",")
+		if len(fields) != 3 {
+			return fmt.Errorf("限流配置 '%s' 格式不正确, 应该为 class[@host]=rate,burst,concurrency", item)
+		}
+		rt, err := strconv.ParseFloat(strings.TrimSpace(fields[0]), 64)
+		if err != nil {
+			return fmt.Errorf("限流配置 '%s': %w", item, err)
+		}
+		burst, err := strconv.Atoi(strings.TrimSpace(fields[1]))
+		if err != nil {
+			return fmt.Errorf("限流配置 '%s': %w", item, err)
+		}
+		concurrency, err := strconv.ParseInt(strings.TrimSpace(fields[2]), 10, 64)
+		if err != nil {
+			return fmt.Errorf("限流配置 '%s': %w", item, err)
+		}
+		r.Configure(strings.TrimSpace(host), class, Limit{Rate: rate.Limit(rt), Burst: burst, Concurrency: concurrency})
+	}
+	return nil
+}
+
+// Limiter 同时限制速率和并发
+type Limiter struct {
+	*Waiter
+	sem *semaphore.Weighted
+}
+
+func NewLimiter(l Limit) *Limiter {
+	r, b := l.Rate, l.Burst
+	if r <= 0 {
+		r = rate.Inf
+	}
+	if b <= 0 {
+		b = 1
+	}
+	limiter := &Limiter{Waiter: NewWaiter(r, b)}
+	if l.Concurrency > 0 {
+		limiter.sem = semaphore.NewWeighted(l.Concurrency)
+	}
+	return limiter
+}
+
+func (l *Limiter) Wait(ctx context.Context) {
+	if l.sem != nil {
+		l.sem.Acquire(ctx, 1)
+	}
+	l.Waiter.Wait(ctx)
+}
+
+func (l *Limiter) Release() {
+	if l.sem != nil {
+		l.sem.Release(1)
+	}
+}
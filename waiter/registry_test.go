@@ -0,0 +1,87 @@
+package waiter
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// maxConcurrent 同时发起 n 个请求, 返回实际同时持有限流器的最大数量
+func maxConcurrent(l Interface, n int) int64 {
+	var cur, max int64
+	wg := sync.WaitGroup{}
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.Wait(context.Background())
+			defer l.Release()
+			c := atomic.AddInt64(&cur, 1)
+			for {
+				m := atomic.LoadInt64(&max)
+				if c <= m || atomic.CompareAndSwapInt64(&max, m, c) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt64(&cur, -1)
+		}()
+	}
+	wg.Wait()
+	return max
+}
+
+func TestRegistryParseAppliesToExistingLimiters(t *testing.T) {
+	r := NewRegistry(map[Class]Limit{
+		ClassAPI:     {Rate: rate.Every(5 * time.Second), Burst: 10},
+		ClassSegment: {Concurrency: 20},
+	})
+	// 解析 -limits 之前就已经创建的限流器
+	api := r.Get("time.geekbang.org", ClassAPI)
+	seg := r.Get("media001.geekbang.org", ClassSegment)
+	other := r.Get("static001.geekbang.org", ClassSegment)
+
+	if err := r.Parse("api=100,1,0; segment@media001.geekbang.org=0,0,2"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := r.Get("time.geekbang.org", ClassAPI); got == api || got.(*Limiter).rt.Limit() != 100 || got.(*Limiter).rt.Burst() != 1 {
+		t.Errorf("api limiter not rebuilt with the new rate")
+	}
+	if n := maxConcurrent(r.ForURL("https://media001.geekbang.org/x/1.ts", ClassSegment), 10); n != 2 {
+		t.Errorf("segment concurrency = %d, want 2", n)
+	}
+	if r.Get("media001.geekbang.org", ClassSegment) == seg {
+		t.Error("segment limiter for the configured host not rebuilt")
+	}
+	// 其他 host 没有单独配置, 继续使用原来的限流器
+	if r.Get("static001.geekbang.org", ClassSegment) != other {
+		t.Error("limiter of an unrelated host was dropped")
+	}
+	if l := r.Limit("static001.geekbang.org", ClassSegment); l.Concurrency != 20 {
+		t.Errorf("default segment limit = %+v", l)
+	}
+}
+
+func TestRegistryDefaultKeepsHostConfig(t *testing.T) {
+	r := NewRegistry(map[Class]Limit{ClassAsset: {Concurrency: 30}})
+	r.Configure("static001.geekbang.org", ClassAsset, Limit{Concurrency: 3})
+	own := r.Get("static001.geekbang.org", ClassAsset)
+	shared := r.Get("other.example.com", ClassAsset)
+
+	// 修改默认配置时, 单独配置过的 host 不受影响
+	r.Configure("", ClassAsset, Limit{Concurrency: 1})
+	if r.Get("static001.geekbang.org", ClassAsset) != own {
+		t.Error("host with its own config should keep its limiter")
+	}
+	if got := r.Get("other.example.com", ClassAsset); got == shared || maxConcurrent(got, 5) != 1 {
+		t.Error("host without its own config should use the new default")
+	}
+	if err := r.Parse("video=1,1,1"); err == nil {
+		t.Error("want error for unknown class")
+	}
+}
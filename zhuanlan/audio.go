@@ -0,0 +1,119 @@
+package zhuanlan
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/duc-cnzj/geekbang2md/api"
+	"github.com/duc-cnzj/geekbang2md/hls"
+	"github.com/duc-cnzj/geekbang2md/id3"
+	"github.com/duc-cnzj/geekbang2md/utils"
+)
+
+// tagAudios 给已经下载的 mp3 写入 ID3 标签, 音乐播放器才能按课程和顺序排列
+func (zl *ZhuanLan) tagAudios(items []*api.ArticlesResponseItem, pad int) {
+	var cover []byte
+	if zl.cover != "" {
+		if p, err := zl.imageManager.Download(zl.cover, ""); err == nil {
+			cover, _ = os.ReadFile(p)
+		} else if !errors.Is(err, api.ErrOffline) {
+			log.Printf("[ID3]: 下载封面出错: %v\n", err)
+		}
+	}
+	for i, s := range items {
+		if s.AudioDownloadURL == "" {
+			continue
+		}
+		p, err := zl.localPath(s.AudioDownloadURL, utils.GetArticleNumber(i, pad))
+		if err != nil {
+			continue
+		}
+		// HLS 音频可能是 ADTS 格式的 aac, 前面加上 ID3 很多播放器无法识别, 只给 mp3 写标签
+		if !strings.EqualFold(filepath.Ext(p), ".mp3") {
+			continue
+		}
+		if _, err := os.Stat(p); err != nil {
+			continue
+		}
+		if err := id3.WriteFile(p, &id3.Tag{
+			Title:      s.ArticleTitle,
+			Album:      zl.title,
+			Artist:     s.AudioDubber,
+			Track:      i + 1,
+			TrackTotal: len(items),
+			Cover:      cover,
+		}); err != nil {
+			log.Printf("[ID3]: '%s' 写入标签出错: %v\n", p, err)
+		}
+	}
+}
+
+// localPath imageManager 里登记过的文件(例如 HLS 音频)直接使用, 其余的按地址推算
+func (zl *ZhuanLan) localPath(u, articleNumber string) (string, error) {
+	if p := zl.imageManager.Get(u); p != "" {
+		return p, nil
+	}
+	return zl.imageManager.FullLocalPath(u, articleNumber)
+}
+
+// hlsAudioPath HLS 音频合并后的文件, 扩展名取决于音频流的格式
+func (zl *ZhuanLan) hlsAudioPath(articleNumber string) (string, bool) {
+	for _, ext := range []string{".mp3", ".aac"} {
+		p := zl.imageManager.AudioPath(articleNumber + "-hls" + ext)
+		if st, err := os.Stat(p); err == nil && st.Size() > 0 {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// downloadHLSAudio 没有 mp3 下载地址时, 下载 HLS 音频流, 解密合并后再取出里面的音频
+func (zl *ZhuanLan) downloadHLSAudio(s *api.ArticlesResponseItem, articleNumber, title string) (string, error) {
+	if p, ok := zl.hlsAudioPath(articleNumber); ok {
+		return p, nil
+	}
+	if api.Offline() {
+		return "", api.ErrOffline
+	}
+	ts := zl.imageManager.AudioPath(articleNumber + "-hls.ts")
+	segDir := zl.imageManager.AudioPath(articleNumber + "-hls-segs")
+	if err := hls.Download(ts, &hls.HLS{
+		URL:    s.AudioURL,
+		SegDir: segDir,
+		Title:  title,
+		ID:     strconv.Itoa(s.ID),
+	}); err != nil {
+		return "", err
+	}
+	os.RemoveAll(segDir)
+
+	in, err := os.Open(ts)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	part := zl.imageManager.AudioPath(articleNumber + "-hls.part")
+	out, err := os.OpenFile(part, os.O_TRUNC|os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return "", err
+	}
+	ext, err := hls.DemuxAudio(in, out)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(part)
+		return "", err
+	}
+	p := zl.imageManager.AudioPath(articleNumber + "-hls" + ext)
+	if err := os.Rename(part, p); err != nil {
+		return "", err
+	}
+	in.Close()
+	os.Remove(ts)
+	return p, nil
+}
@@ -0,0 +1,159 @@
+package zhuanlan
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/duc-cnzj/geekbang2md/api"
+	"github.com/duc-cnzj/geekbang2md/utils"
+)
+
+// podcastURL 播客 enclosure 地址前缀, 对应下载目录, 为空时使用 file:// 本地路径
+var podcastURL string
+
+func SetPodcastURL(u string) {
+	podcastURL = strings.TrimRight(u, "/")
+}
+
+type rss struct {
+	XMLName xml.Name       `xml:"rss"`
+	Version string         `xml:"version,attr"`
+	ITunes  string         `xml:"xmlns:itunes,attr"`
+	Channel podcastChannel `xml:"channel"`
+}
+
+type podcastChannel struct {
+	Title       string         `xml:"title"`
+	Link        string         `xml:"link"`
+	Description string         `xml:"description"`
+	Language    string         `xml:"language"`
+	Author      string         `xml:"itunes:author"`
+	Summary     string         `xml:"itunes:summary,omitempty"`
+	Type        string         `xml:"itunes:type"`
+	Explicit    string         `xml:"itunes:explicit"`
+	Category    podcastText    `xml:"itunes:category"`
+	Image       *podcastImage  `xml:"itunes:image,omitempty"`
+	Items       []*podcastItem `xml:"item"`
+}
+
+type podcastText struct {
+	Text string `xml:"text,attr"`
+}
+
+type podcastImage struct {
+	Href string `xml:"href,attr"`
+}
+
+type podcastGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type podcastEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+type podcastItem struct {
+	Title       string           `xml:"title"`
+	Description string           `xml:"description,omitempty"`
+	GUID        podcastGUID      `xml:"guid"`
+	PubDate     string           `xml:"pubDate,omitempty"`
+	Enclosure   podcastEnclosure `xml:"enclosure"`
+	Author      string           `xml:"itunes:author,omitempty"`
+	Duration    string           `xml:"itunes:duration,omitempty"`
+	Episode     int              `xml:"itunes:episode"`
+	EpisodeType string           `xml:"itunes:episodeType"`
+}
+
+// writePodcast 根据已经下载到本地的 mp3 生成 `podcast.xml`
+func (zl *ZhuanLan) writePodcast(items []*api.ArticlesResponseItem, pad int) error {
+	channel := podcastChannel{
+		Title:       zl.title,
+		Link:        fmt.Sprintf("https://time.geekbang.org/column/intro/%d", zl.id),
+		Description: zl.intro,
+		Language:    "zh-cn",
+		Author:      zl.author,
+		Summary:     zl.intro,
+		Type:        "serial",
+		Explicit:    "false",
+		Category:    podcastText{Text: "Education"},
+	}
+	if channel.Description == "" {
+		channel.Description = zl.title
+	}
+	if zl.cover != "" {
+		channel.Image = &podcastImage{Href: zl.cover}
+	}
+	for i, s := range items {
+		if s.AudioDownloadURL == "" {
+			continue
+		}
+		p, err := zl.localPath(s.AudioDownloadURL, utils.GetArticleNumber(i, pad))
+		if err != nil {
+			continue
+		}
+		stat, err := os.Stat(p)
+		if err != nil {
+			continue
+		}
+		item := &podcastItem{
+			Title:       s.ArticleTitle,
+			Description: s.ArticleSummary,
+			GUID:        podcastGUID{Value: fmt.Sprintf("geekbang-article-%d", s.ID)},
+			Enclosure:   podcastEnclosure{URL: zl.podcastEnclosureURL(p), Length: stat.Size(), Type: audioMIME(p)},
+			Author:      s.AudioDubber,
+			Duration:    s.AudioTime,
+			Episode:     i + 1,
+			EpisodeType: "full",
+		}
+		if s.ArticleCtime > 0 {
+			item.PubDate = time.Unix(int64(s.ArticleCtime), 0).Format(time.RFC1123Z)
+		}
+		channel.Items = append(channel.Items, item)
+	}
+	if len(channel.Items) == 0 {
+		return nil
+	}
+	marshal, err := xml.MarshalIndent(&rss{Version: "2.0", ITunes: "http://www.itunes.com/dtds/podcast-1.0.dtd", Channel: channel}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(zl.mdWriter.BaseDir(), "podcast.xml"), append([]byte(xml.Header), marshal...), 0644)
+}
+
+func (zl *ZhuanLan) podcastEnclosureURL(p string) string {
+	rel, err := filepath.Rel(baseDir, p)
+	if podcastURL == "" || err != nil {
+		return fileURL(p)
+	}
+	segments := strings.Split(filepath.ToSlash(rel), "/")
+	for i := range segments {
+		segments[i] = url.PathEscape(segments[i])
+	}
+	return podcastURL + "/" + strings.Join(segments, "/")
+}
+
+func fileURL(p string) string {
+	if abs, err := filepath.Abs(p); err == nil {
+		p = abs
+	}
+	p = filepath.ToSlash(p)
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	return (&url.URL{Scheme: "file", Path: p}).String()
+}
+
+func audioMIME(p string) string {
+	if strings.HasSuffix(p, ".aac") {
+		return "audio/aac"
+	}
+	return "audio/mpeg"
+}
@@ -1,6 +1,7 @@
 package zhuanlan
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -12,7 +13,10 @@ import (
 
 	"github.com/duc-cnzj/geekbang2md/api"
 	"github.com/duc-cnzj/geekbang2md/bar"
+	"github.com/duc-cnzj/geekbang2md/cache"
 	"github.com/duc-cnzj/geekbang2md/image"
+	"github.com/duc-cnzj/geekbang2md/markdown"
+	"github.com/duc-cnzj/geekbang2md/notice"
 	"github.com/duc-cnzj/geekbang2md/utils"
 )
 
@@ -23,9 +27,11 @@ type ZhuanLan struct {
 	author   string
 	count    int
 	keywords []string
+	intro    string
+	cover    string
 
 	imageManager *image.Manager
-	mdWriter     *MDWriter
+	mdWriter     *markdown.MDWriter
 }
 
 var baseDir string
@@ -34,16 +40,16 @@ func Init(d string) {
 	baseDir = d
 }
 
-func NewZhuanLan(title string, id int, author string, count int, keywords []string, audio bool) *ZhuanLan {
+func NewZhuanLan(title string, id int, author string, count int, keywords []string, intro, cover string, audio bool) *ZhuanLan {
 	dir := filepath.Join(baseDir, utils.FilterCharacters(title))
 	imageManager := image.NewManager(filepath.Join(dir, "images"))
 
-	mdWriter := NewMDWriter(dir, title, imageManager)
-	return &ZhuanLan{audio: audio, title: title, id: id, author: author, count: count, keywords: keywords, imageManager: imageManager, mdWriter: mdWriter}
+	mdWriter := markdown.NewMDWriter(dir, title, imageManager)
+	return &ZhuanLan{audio: audio, title: title, id: id, author: author, count: count, keywords: keywords, intro: intro, cover: cover, imageManager: imageManager, mdWriter: mdWriter}
 }
 
 func (zl *ZhuanLan) Download() error {
-	utils.WriteReadmeMD(zl.mdWriter.baseDir, zl.title, zl.author, zl.count, zl.keywords)
+	utils.WriteReadmeMD(zl.mdWriter.BaseDir(), zl.title, zl.author, zl.count, zl.keywords)
 	articles, err := api.Articles(zl.id)
 	if err != nil {
 		return err
@@ -55,6 +61,8 @@ func (zl *ZhuanLan) Download() error {
 	currentCount := len(articles.Data.List)
 	b := bar.NewBar(zl.title, currentCount)
 	r := NewZlResults()
+	// missing/corrupt 离线模式下没有缓存以及缓存已损坏的课时
+	var missing, corrupt int
 	for i := range articles.Data.List {
 		func(s *api.ArticlesResponseItem, i int) {
 			defer b.Add()
@@ -63,16 +71,25 @@ func (zl *ZhuanLan) Download() error {
 			if !zl.audio {
 				s.AudioDownloadURL = ""
 			}
-			if info, path, exists := zl.mdWriter.FileExists(t); exists {
+			if zl.audio && s.AudioDownloadURL == "" && s.AudioURL != "" {
+				if p, err := zl.downloadHLSAudio(s, articleNumber, t); err == nil {
+					zl.imageManager.Add(s.AudioURL, p)
+					s.AudioDownloadURL = s.AudioURL
+				} else if !errors.Is(err, api.ErrOffline) {
+					log.Printf("[HLS]: '%s' 下载音频出错: %v\n", t, err)
+				}
+			}
+			// 离线模式下总是重新生成, 用来更新模板
+			if info, path, exists := zl.mdWriter.FileExists(t); exists && !api.Offline() {
 				skip := true
 				file, _ := os.ReadFile(path)
-				images := FindAllImages(string(file))
+				images := markdown.FindAllImages(string(file))
 				if s.AudioDownloadURL != "" {
 					images = append(images, s.AudioDownloadURL)
 				}
 				if len(images) > 0 {
 					for _, imageUrl := range images {
-						localPath, err := zl.imageManager.FullLocalPath(imageUrl, articleNumber)
+						localPath, err := zl.localPath(imageUrl, articleNumber)
 						if err != nil {
 							skip = false
 							break
@@ -94,6 +111,16 @@ func (zl *ZhuanLan) Download() error {
 				}
 			}
 			response, err := api.Article(strconv.Itoa(s.ID))
+			if errors.Is(err, api.ErrOffline) {
+				missing++
+				r.Add(i, fmt.Sprintf("[OFFLINE]: %s 没有缓存", t))
+				return
+			}
+			if api.Offline() && errors.Is(err, cache.ErrCorrupt) {
+				corrupt++
+				r.Add(i, fmt.Sprintf("[CORRUPT]: %s %v", t, err))
+				return
+			}
 			if err != nil {
 				log.Println(err, response.Code)
 				return
@@ -109,8 +136,17 @@ func (zl *ZhuanLan) Download() error {
 		}(articles.Data.List[i], i)
 	}
 
-	if zl.count > currentCount {
-		api.DeleteArticlesCache(zl.id)
+	if zl.audio {
+		zl.tagAudios(articles.Data.List, pad)
+		if err := zl.writePodcast(articles.Data.List, pad); err != nil {
+			log.Printf("[Podcast]: '%s' 生成播客出错: %v\n", zl.title, err)
+		}
+	}
+	if missing > 0 {
+		notice.CourseWarning(zl.title, zl.author, fmt.Sprintf("离线模式下有 %d 课时没有缓存", missing), "去掉 -offline 重新运行下载这些课时", "专栏")
+	}
+	if corrupt > 0 {
+		notice.CourseWarning(zl.title, zl.author, fmt.Sprintf("离线模式下有 %d 课时的缓存已损坏", corrupt), "使用 cache verify --repair 隔离后, 去掉 -offline 重新下载", "专栏")
 	}
 	time.Sleep(300 * time.Millisecond)
 	r.Print()